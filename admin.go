@@ -0,0 +1,159 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	graph "gopkg.in/r3labs/graph.v2"
+)
+
+// serveBuilds : lists the builds in progress
+func (s *Subscriber) serveBuilds(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "method not allowed"})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, s.active.List())
+}
+
+// serveBuild : shows the state of a build on /builds/{id}, and the
+// components that are ready to be dispatched on /builds/{id}/ready
+func (s *Subscriber) serveBuild(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "method not allowed"})
+		return
+	}
+
+	parts := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, "/builds/"), "/"), "/")
+	if parts[0] == "" || len(parts) > 2 || len(parts) == 2 && parts[1] != "ready" {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "not found"})
+		return
+	}
+
+	scheduler, err := s.loadBuild(parts[0])
+	if err == ErrMappingNotFound {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+
+	if len(parts) == 2 {
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"id":         scheduler.graph.ID,
+			"components": changeStates(scheduler.Ready()),
+		})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, buildState(scheduler))
+}
+
+// loadBuild : loads the latest stored mapping of a build
+func (s *Subscriber) loadBuild(id string) (*Scheduler, error) {
+	mapping, err := s.store.GetMapping(id)
+	if err != nil {
+		return nil, err
+	}
+
+	g := graph.New()
+
+	err = g.Load(mapping)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Scheduler{graph: g, revision: getRevision(mapping)}, nil
+}
+
+// BuildState : the state of a build and of each of its changes
+type BuildState struct {
+	ID       string        `json:"id"`
+	Action   string        `json:"action"`
+	Revision int           `json:"revision"`
+	Done     bool          `json:"done"`
+	Errored  bool          `json:"errored"`
+	Running  bool          `json:"running"`
+	Changes  []ChangeState `json:"changes"`
+	Edges    []EdgeState   `json:"edges"`
+}
+
+// ChangeState : the id, action and state of a change. No other field
+// is exposed, as changes carry the credentials of their provider
+type ChangeState struct {
+	ID     string `json:"id"`
+	Action string `json:"action"`
+	State  string `json:"state"`
+}
+
+// EdgeState : a dependency between two components of a build
+type EdgeState struct {
+	Source      string `json:"source"`
+	Destination string `json:"destination"`
+	Length      int    `json:"length"`
+}
+
+// buildState : the state of a build, without its mapping
+func buildState(scheduler *Scheduler) BuildState {
+	return BuildState{
+		ID:       scheduler.graph.ID,
+		Action:   scheduler.graph.Action,
+		Revision: scheduler.revision,
+		Done:     scheduler.Done(),
+		Errored:  scheduler.Errored(),
+		Running:  scheduler.Running(),
+		Changes:  changeStates(scheduler.graph.Changes),
+		Edges:    edgeStates(scheduler.graph),
+	}
+}
+
+// changeStates : the id, action and state of a collection of
+// changes, as an empty list if there are none
+func changeStates(cs []graph.Component) []ChangeState {
+	states := []ChangeState{}
+
+	for _, c := range cs {
+		states = append(states, ChangeState{
+			ID:     c.GetID(),
+			Action: c.GetAction(),
+			State:  c.GetState(),
+		})
+	}
+
+	return states
+}
+
+// edgeStates : the edges of a build, so its graph can be
+// reconstructed, as an empty list if there are none
+func edgeStates(g *graph.Graph) []EdgeState {
+	states := []EdgeState{}
+
+	for _, e := range g.Edges {
+		states = append(states, EdgeState{
+			Source:      e.Source,
+			Destination: e.Destination,
+			Length:      e.Length,
+		})
+	}
+
+	return states
+}
+
+// writeJSON : writes a json response
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+
+	err := json.NewEncoder(w).Encode(v)
+	if err != nil {
+		logger.Error("could not write response: " + err.Error())
+	}
+}
@@ -0,0 +1,100 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func adminRequest(handler http.HandlerFunc, path string, v interface{}) int {
+	w := httptest.NewRecorder()
+	handler(w, httptest.NewRequest("GET", path, nil))
+
+	_ = json.Unmarshal(w.Body.Bytes(), v)
+
+	return w.Code
+}
+
+func TestAdmin(t *testing.T) {
+	Convey("Given a build in progress", t, func() {
+		store := NewMemoryStore()
+		s := NewSubscriber(store, nil)
+
+		g := loadTestMapping("test")
+		_, err := store.SetMapping(g.ID, g, 0)
+		So(err, ShouldBeNil)
+		s.active.Add(g.ID, "build.create")
+
+		Convey("When listing the builds in progress", func() {
+			var builds []ActiveBuild
+			code := adminRequest(s.serveBuilds, "/builds", &builds)
+
+			Convey("It should return the build", func() {
+				So(code, ShouldEqual, http.StatusOK)
+				So(builds, ShouldHaveLength, 1)
+				So(builds[0].ID, ShouldEqual, "test")
+				So(builds[0].Action, ShouldEqual, "build.create")
+			})
+		})
+
+		Convey("When getting the build", func() {
+			var build map[string]interface{}
+			code := adminRequest(s.serveBuild, "/builds/test", &build)
+
+			Convey("It should return the state of the build and of its changes", func() {
+				So(code, ShouldEqual, http.StatusOK)
+				So(build["id"], ShouldEqual, "test")
+				So(build["changes"], ShouldHaveLength, 10)
+				So(build["changes"].([]interface{})[0], ShouldResemble, map[string]interface{}{
+					"id":     "network::web-new",
+					"action": "create",
+					"state":  STATUSWAITING,
+				})
+				So(build["done"], ShouldEqual, false)
+				So(build["errored"], ShouldEqual, false)
+				So(build["running"], ShouldEqual, false)
+			})
+
+			Convey("It should return its edges, so its graph can be reconstructed", func() {
+				So(build["edges"], ShouldHaveLength, len(g.Edges))
+				So(build["edges"].([]interface{})[0], ShouldResemble, map[string]interface{}{
+					"source":      g.Edges[0].Source,
+					"destination": g.Edges[0].Destination,
+					"length":      float64(g.Edges[0].Length),
+				})
+			})
+
+			Convey("It should not return the components of its mapping", func() {
+				So(build, ShouldNotContainKey, "components")
+			})
+		})
+
+		Convey("When getting the components that are ready", func() {
+			var ready map[string]interface{}
+			code := adminRequest(s.serveBuild, "/builds/test/ready", &ready)
+
+			Convey("It should return the components that would be dispatched", func() {
+				So(code, ShouldEqual, http.StatusOK)
+				So(ready["components"], ShouldHaveLength, 5)
+				So(ready["components"].([]interface{})[0], ShouldContainKey, "id")
+				So(ready["components"].([]interface{})[0], ShouldNotContainKey, "aws_secret_access_key")
+			})
+		})
+
+		Convey("When getting a build that does not exist", func() {
+			var build map[string]interface{}
+			code := adminRequest(s.serveBuild, "/builds/missing", &build)
+
+			Convey("It should not be found", func() {
+				So(code, ShouldEqual, http.StatusNotFound)
+			})
+		})
+	})
+}
@@ -0,0 +1,70 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package main
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// ActiveBuild : a build in progress
+type ActiveBuild struct {
+	ID        string    `json:"id"`
+	Action    string    `json:"action,omitempty"`
+	StartedAt time.Time `json:"started_at"`
+}
+
+// ActiveBuilds : tracks the builds in progress
+type ActiveBuilds struct {
+	mu     sync.Mutex
+	builds map[string]ActiveBuild
+}
+
+// NewActiveBuilds : ActiveBuilds constructor
+func NewActiveBuilds() *ActiveBuilds {
+	return &ActiveBuilds{builds: make(map[string]ActiveBuild)}
+}
+
+// Add : tracks a build that has started
+func (a *ActiveBuilds) Add(id, action string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.builds[id] = ActiveBuild{ID: id, Action: action, StartedAt: time.Now().UTC()}
+}
+
+// Remove : stops tracking a build that has finished
+func (a *ActiveBuilds) Remove(id string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	delete(a.builds, id)
+}
+
+// List : all builds in progress, in the order they were started
+func (a *ActiveBuilds) List() []ActiveBuild {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	builds := make([]ActiveBuild, 0, len(a.builds))
+	for _, b := range a.builds {
+		builds = append(builds, b)
+	}
+
+	sort.Slice(builds, func(i, j int) bool {
+		return builds[i].StartedAt.Before(builds[j].StartedAt)
+	})
+
+	return builds
+}
+
+// Count : number of builds in progress
+func (a *ActiveBuilds) Count() int {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	return len(a.builds)
+}
@@ -0,0 +1,167 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"sync"
+
+	graph "gopkg.in/r3labs/graph.v2"
+)
+
+// Limits : maximum number of components that can run at once, across all
+// builds, on a single build, and for each provider and component type.
+// A limit of zero is unlimited
+type Limits struct {
+	Global     int            `json:"global"`
+	Service    int            `json:"service"`
+	Providers  map[string]int `json:"providers"`
+	Components map[string]int `json:"components"`
+}
+
+// slot : a counter limited by a maximum
+type slot struct {
+	key   string
+	limit int
+}
+
+// Concurrency : tracks the components that are running on all builds,
+// and limits how many of them can run at once
+type Concurrency struct {
+	mu      sync.Mutex
+	limits  Limits
+	running map[string][]slot
+	counts  map[string]int
+	blocked map[string]bool
+}
+
+// NewConcurrency : Concurrency constructor
+func NewConcurrency(limits Limits) *Concurrency {
+	return &Concurrency{
+		limits:  limits,
+		running: make(map[string][]slot),
+		counts:  make(map[string]int),
+		blocked: make(map[string]bool),
+	}
+}
+
+// concurrency : gets the concurrency limits from the environment. By
+// default the number of running components is not limited
+func concurrency() *Concurrency {
+	var limits Limits
+
+	data := os.Getenv("SCHEDULER_CONCURRENCY")
+	if data == "" {
+		return nil
+	}
+
+	err := json.Unmarshal([]byte(data), &limits)
+	if err != nil {
+		logger.Error("invalid concurrency limits: " + err.Error())
+		return nil
+	}
+
+	return NewConcurrency(limits)
+}
+
+// Acquire : takes a slot for a component if none of its limits has been
+// reached, and returns true. A nil Concurrency has no limits
+func (cc *Concurrency) Acquire(service string, c graph.Component) bool {
+	if cc == nil {
+		return true
+	}
+
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+
+	key := service + "/" + c.GetID()
+	if _, ok := cc.running[key]; ok {
+		return true
+	}
+
+	slots := cc.slots(service, c)
+	for _, sl := range slots {
+		if sl.limit > 0 && cc.counts[sl.key] >= sl.limit {
+			cc.blocked[service] = true
+			return false
+		}
+	}
+
+	cc.take(key, slots)
+
+	return true
+}
+
+// Hold : takes a slot for a component that is already running,
+// regardless of its limits
+func (cc *Concurrency) Hold(service string, c graph.Component) {
+	if cc == nil {
+		return
+	}
+
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+
+	key := service + "/" + c.GetID()
+	if _, ok := cc.running[key]; !ok {
+		cc.take(key, cc.slots(service, c))
+	}
+}
+
+// Release : frees the slot of a component that has finished, and returns
+// all other services that have components waiting for a slot
+func (cc *Concurrency) Release(service string, c graph.Component) []string {
+	var services []string
+
+	if cc == nil {
+		return services
+	}
+
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+
+	key := service + "/" + c.GetID()
+
+	slots, ok := cc.running[key]
+	if !ok {
+		return services
+	}
+
+	for _, sl := range slots {
+		cc.counts[sl.key]--
+		if cc.counts[sl.key] < 1 {
+			delete(cc.counts, sl.key)
+		}
+	}
+	delete(cc.running, key)
+
+	for id := range cc.blocked {
+		if id != service {
+			services = append(services, id)
+		}
+		delete(cc.blocked, id)
+	}
+
+	return services
+}
+
+func (cc *Concurrency) take(key string, slots []slot) {
+	for _, sl := range slots {
+		cc.counts[sl.key]++
+	}
+
+	cc.running[key] = slots
+}
+
+// slots : all counters a component is limited by
+func (cc *Concurrency) slots(service string, c graph.Component) []slot {
+	return []slot{
+		{key: "global", limit: cc.limits.Global},
+		{key: "service:" + service, limit: cc.limits.Service},
+		{key: "provider:" + c.GetProvider(), limit: cc.limits.Providers[c.GetProvider()]},
+		{key: "component:" + c.GetType(), limit: cc.limits.Components[c.GetType()]},
+	}
+}
@@ -0,0 +1,149 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package main
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+	graph "gopkg.in/r3labs/graph.v2"
+)
+
+func providerComponent(id, provider, ctype string) graph.Component {
+	c := fakeComponent(id)
+	c["_provider"] = provider
+	c["_component"] = ctype
+
+	return graph.MapGenericComponent(c)
+}
+
+func TestConcurrency(t *testing.T) {
+	Convey("Given concurrency limits", t, func() {
+		cc := NewConcurrency(Limits{
+			Global:     3,
+			Service:    2,
+			Providers:  map[string]int{"aws": 2},
+			Components: map[string]int{"instance": 1},
+		})
+
+		Convey("When the limit of a component type is reached", func() {
+			So(cc.Acquire("service-1", providerComponent("instance::1", "azure", "instance")), ShouldBeTrue)
+			Convey("It should not allow other components of the same type", func() {
+				So(cc.Acquire("service-2", providerComponent("instance::2", "azure", "instance")), ShouldBeFalse)
+				So(cc.Acquire("service-2", providerComponent("network::1", "azure", "network")), ShouldBeTrue)
+			})
+		})
+
+		Convey("When the limit of a provider is reached", func() {
+			So(cc.Acquire("service-1", providerComponent("network::1", "aws", "network")), ShouldBeTrue)
+			So(cc.Acquire("service-2", providerComponent("network::2", "aws", "network")), ShouldBeTrue)
+			Convey("It should not allow other components of the same provider", func() {
+				So(cc.Acquire("service-3", providerComponent("network::3", "aws", "network")), ShouldBeFalse)
+				So(cc.Acquire("service-3", providerComponent("network::3", "azure", "network")), ShouldBeTrue)
+			})
+		})
+
+		Convey("When the limit of a service is reached", func() {
+			So(cc.Acquire("service-1", providerComponent("network::1", "azure", "network")), ShouldBeTrue)
+			So(cc.Acquire("service-1", providerComponent("network::2", "azure", "network")), ShouldBeTrue)
+			Convey("It should not allow other components of the same service", func() {
+				So(cc.Acquire("service-1", providerComponent("network::3", "azure", "network")), ShouldBeFalse)
+				So(cc.Acquire("service-2", providerComponent("network::3", "azure", "network")), ShouldBeTrue)
+			})
+		})
+
+		Convey("When the global limit is reached", func() {
+			So(cc.Acquire("service-1", providerComponent("network::1", "azure", "network")), ShouldBeTrue)
+			So(cc.Acquire("service-2", providerComponent("network::2", "azure", "network")), ShouldBeTrue)
+			So(cc.Acquire("service-3", providerComponent("network::3", "azure", "network")), ShouldBeTrue)
+			So(cc.Acquire("service-4", providerComponent("network::4", "azure", "network")), ShouldBeFalse)
+
+			Convey("And a component is released", func() {
+				services := cc.Release("service-1", providerComponent("network::1", "azure", "network"))
+				Convey("It should return the services waiting for a slot", func() {
+					So(services, ShouldResemble, []string{"service-4"})
+					So(cc.Acquire("service-4", providerComponent("network::4", "azure", "network")), ShouldBeTrue)
+				})
+			})
+
+			Convey("And a component that is not running is released", func() {
+				services := cc.Release("service-1", providerComponent("network::9", "azure", "network"))
+				Convey("It should not free any slot", func() {
+					So(len(services), ShouldEqual, 0)
+					So(cc.Acquire("service-4", providerComponent("network::4", "azure", "network")), ShouldBeFalse)
+				})
+			})
+		})
+	})
+
+	Convey("Given a scheduler with limited concurrency", t, func() {
+		bms, err := loadjsongraph("./fixtures/test-graph.json")
+		So(err, ShouldBeNil)
+
+		s := Scheduler{graph: graph.New(), slots: NewConcurrency(Limits{Global: 2})}
+		So(s.graph.Load(bms), ShouldBeNil)
+
+		Convey("When it receives the 'start' component", func() {
+			components, err := s.Receive(NewFakeComponent("start"))
+
+			Convey("It should only run as many components as allowed", func() {
+				So(err, ShouldBeNil)
+				So(len(components), ShouldEqual, 5)
+				So(components[0].GetState(), ShouldEqual, STATUSRUNNING)
+				So(components[1].GetState(), ShouldEqual, STATUSRUNNING)
+				So(components[2].GetState(), ShouldEqual, STATUSQUEUED)
+				So(s.Queued(), ShouldBeTrue)
+			})
+
+			Convey("And a running component completes", func() {
+				c := cp(s.graph.ComponentAll("instance::db-1"))
+				c.SetState(STATUSCOMPLETED)
+				s.slots.Release(s.graph.ID, c)
+				components, err := s.Receive(c)
+
+				Convey("It should run the queued components first", func() {
+					So(err, ShouldBeNil)
+					So(len(components), ShouldEqual, 2)
+					So(components[0].GetID(), ShouldEqual, "instance::web-1")
+					So(components[0].GetState(), ShouldEqual, STATUSRUNNING)
+					So(components[1].GetID(), ShouldEqual, "instance::db-2")
+					So(components[1].GetState(), ShouldEqual, STATUSQUEUED)
+				})
+			})
+		})
+	})
+
+	Convey("Given a scheduler that continues on error with one slot per build", t, func() {
+		bms, err := loadjsongraph("./fixtures/test-graph.json")
+		So(err, ShouldBeNil)
+
+		s := Scheduler{graph: graph.New(), slots: NewConcurrency(Limits{Service: 1})}
+		So(s.graph.Load(bms), ShouldBeNil)
+
+		for _, c := range s.graph.Changes {
+			(*c.(*graph.GenericComponent))["_continue_on_error"] = true
+		}
+
+		components, err := s.Receive(NewFakeComponent("start"))
+		So(err, ShouldBeNil)
+		So(components[0].GetState(), ShouldEqual, STATUSRUNNING)
+		So(components[1].GetState(), ShouldEqual, STATUSQUEUED)
+
+		Convey("When the only running component fails", func() {
+			c := cp(components[0])
+			c.SetState(STATUSERRORED)
+			s.slots.Release(s.graph.ID, c)
+			next, err := s.Receive(c)
+
+			Convey("It should run the next queued component", func() {
+				So(err, ShouldBeNil)
+				So(len(next), ShouldEqual, 1)
+				So(next[0].GetID(), ShouldEqual, components[1].GetID())
+				So(next[0].GetState(), ShouldEqual, STATUSRUNNING)
+				So(s.Running(), ShouldBeTrue)
+			})
+		})
+	})
+}
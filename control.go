@@ -0,0 +1,98 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package main
+
+import (
+	"errors"
+)
+
+// ErrNotCancellable : returned when a build has no components left to cancel
+var ErrNotCancellable = errors.New("build has no components left to cancel")
+
+// ErrNotPausable : returned when a build has no components left to pause
+var ErrNotPausable = errors.New("build has no components left to pause")
+
+// ErrNotPaused : returned when resuming a build that has not been paused
+var ErrNotPaused = errors.New("build has not been paused")
+
+// control : applies a control message to a build in progress
+func (s *Subscriber) control(scheduler *Scheduler, m *Message) error {
+	switch m.subject {
+	case "build.cancel":
+		return s.cancel(scheduler)
+	case "build.pause":
+		return s.pause(scheduler)
+	case "build.resume":
+		return s.resume(scheduler)
+	case "scheduler.release":
+		return s.dispatch(scheduler, scheduler.Dequeue(), false)
+	}
+
+	return nil
+}
+
+// cancel : cancels all components of a build that have not been scheduled.
+// Components that are running are allowed to finish before the build is
+// notified as cancelled
+func (s *Subscriber) cancel(scheduler *Scheduler) error {
+	cancelled := scheduler.Cancel()
+	if len(cancelled) < 1 {
+		return ErrNotCancellable
+	}
+
+	serviceLog(scheduler.graph.ID).Info("cancelling build")
+
+	return s.storeChanges(scheduler, cancelled)
+}
+
+// pause : pauses all components of a build that have not been scheduled.
+// Components that are running are allowed to finish, but no other
+// components will be scheduled until the build is resumed
+func (s *Subscriber) pause(scheduler *Scheduler) error {
+	if scheduler.Errored() {
+		return ErrNotPausable
+	}
+
+	paused := scheduler.Pause()
+	if len(paused) < 1 {
+		return ErrNotPausable
+	}
+
+	serviceLog(scheduler.graph.ID).Info("pausing build")
+
+	err := s.storeChanges(scheduler, paused)
+	if err != nil {
+		return err
+	}
+
+	acknowledged("build.pause", scheduler.graph)
+
+	return nil
+}
+
+// resume : resumes a paused build, scheduling all components
+// whose dependencies have been satisfied
+func (s *Subscriber) resume(scheduler *Scheduler) error {
+	resumed := scheduler.Resume()
+	if len(resumed) < 1 {
+		return ErrNotPaused
+	}
+
+	serviceLog(scheduler.graph.ID).Info("resuming build")
+
+	err := s.storeChanges(scheduler, resumed)
+	if err != nil {
+		return err
+	}
+
+	err = s.dispatch(scheduler, scheduler.Unblocked(), false)
+	if err != nil {
+		return err
+	}
+
+	acknowledged("build.resume", scheduler.graph)
+
+	return nil
+}
@@ -0,0 +1,97 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package main
+
+import (
+	"sync"
+)
+
+// SEENMESSAGES : number of message ids remembered to discard duplicated results
+const SEENMESSAGES = 10000
+
+// SeenMessages : remembers the ids of the latest messages received
+type SeenMessages struct {
+	mu    sync.Mutex
+	limit int
+	ids   map[string]bool
+	order []string
+}
+
+// NewSeenMessages : SeenMessages constructor
+func NewSeenMessages(limit int) *SeenMessages {
+	return &SeenMessages{
+		limit: limit,
+		ids:   make(map[string]bool),
+	}
+}
+
+// Seen : records the id of a message, and returns true if it had already
+// been seen. Once the limit is reached the oldest ids are forgotten
+func (sm *SeenMessages) Seen(id string) bool {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	if sm.ids[id] {
+		return true
+	}
+
+	sm.ids[id] = true
+	sm.order = append(sm.order, id)
+
+	if len(sm.order) > sm.limit {
+		delete(sm.ids, sm.order[0])
+		sm.order = sm.order[1:]
+	}
+
+	return false
+}
+
+// Forget : forgets the id of a message, so it is not
+// discarded when it is delivered again
+func (sm *SeenMessages) Forget(id string) {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	delete(sm.ids, id)
+}
+
+// duplicate : returns true if a component result has already been processed,
+// either because its change has already finished or because a message with
+// the same '_message_id' has already been received
+func (s *Subscriber) duplicate(scheduler *Scheduler, m *Message) bool {
+	if m.getType() != COMPONENTYPE {
+		return false
+	}
+
+	reason := ""
+
+	id, _ := m.data["_message_id"].(string)
+	if id != "" && s.seen.Seen(scheduler.graph.ID+"/"+id) {
+		reason = "message_id"
+	}
+
+	change := scheduler.change(m.getComponent().GetID())
+	if change != nil && (change.GetState() == STATUSCOMPLETED || change.GetState() == STATUSERRORED) {
+		reason = "state"
+	}
+
+	if reason == "" {
+		return false
+	}
+
+	duplicates.Inc(reason)
+	messageLog(m).With(Fields{"reason": reason}).Warn("discarding duplicated result")
+
+	return true
+}
+
+// forget : forgets a durable result that could not be processed, so
+// it is not discarded as a duplicate when it is delivered again
+func (s *Subscriber) forget(m *Message) {
+	id, _ := m.data["_message_id"].(string)
+	if id != "" && m.durable() {
+		s.seen.Forget(m.getServiceID() + "/" + id)
+	}
+}
@@ -0,0 +1,78 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package main
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestSeenMessages(t *testing.T) {
+	Convey("Given a record of the messages seen", t, func() {
+		sm := NewSeenMessages(2)
+
+		Convey("When a message is seen twice", func() {
+			first := sm.Seen("message-1")
+			second := sm.Seen("message-1")
+
+			Convey("It should only report the second one as seen", func() {
+				So(first, ShouldBeFalse)
+				So(second, ShouldBeTrue)
+			})
+		})
+
+		Convey("When more messages than its limit are seen", func() {
+			sm.Seen("message-1")
+			sm.Seen("message-2")
+			sm.Seen("message-3")
+
+			Convey("It should forget the oldest ones", func() {
+				So(sm.Seen("message-3"), ShouldBeTrue)
+				So(sm.Seen("message-1"), ShouldBeFalse)
+			})
+		})
+	})
+}
+
+func TestDuplicate(t *testing.T) {
+	Convey("Given a build in progress", t, func() {
+		s := NewSubscriber(NewMemoryStore(), nil)
+		scheduler := Scheduler{graph: loadTestMapping("test")}
+		scheduler.graph.ComponentAll("instance::db-1").SetState(STATUSCOMPLETED)
+		scheduler.graph.ComponentAll("instance::db-2").SetState(STATUSRUNNING)
+
+		Convey("When receiving the result of a change that has already completed", func() {
+			m, err := NewMessage("instance.update.fake.done", []byte(`{"service":"test","_component_id":"instance::db-1","_state":"completed"}`))
+			So(err, ShouldBeNil)
+
+			Convey("It should be discarded", func() {
+				So(s.duplicate(&scheduler, m), ShouldBeTrue)
+			})
+		})
+
+		Convey("When receiving the result of a change that is running", func() {
+			m, err := NewMessage("instance.update.fake.done", []byte(`{"service":"test","_component_id":"instance::db-2","_state":"completed"}`))
+			So(err, ShouldBeNil)
+
+			Convey("It should be processed", func() {
+				So(s.duplicate(&scheduler, m), ShouldBeFalse)
+			})
+		})
+
+		Convey("When receiving a result with a message id that has already been seen", func() {
+			data := []byte(`{"service":"test","_component_id":"instance::db-2","_state":"completed","_message_id":"1"}`)
+			first, err := NewMessage("instance.update.fake.done", data)
+			So(err, ShouldBeNil)
+			second, err := NewMessage("instance.update.fake.done", data)
+			So(err, ShouldBeNil)
+
+			Convey("It should only process the first one", func() {
+				So(s.duplicate(&scheduler, first), ShouldBeFalse)
+				So(s.duplicate(&scheduler, second), ShouldBeTrue)
+			})
+		})
+	})
+}
@@ -0,0 +1,100 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	graph "gopkg.in/r3labs/graph.v2"
+)
+
+// FileStore : keeps all mappings in memory, and writes them
+// to a single file on disk every time one is updated
+type FileStore struct {
+	*MemoryStore
+	path string
+}
+
+// NewFileStore : FileStore constructor, loads any mappings
+// previously stored on the given file
+func NewFileStore(path string) (*FileStore, error) {
+	s := &FileStore{
+		MemoryStore: NewMemoryStore(),
+		path:        path,
+	}
+
+	err := s.load()
+	if err != nil {
+		return nil, err
+	}
+
+	s.MemoryStore.save = s.write
+
+	return s, nil
+}
+
+// load : reads all stored mappings from disk
+func (s *FileStore) load() error {
+	var stored map[string]struct {
+		Revision int                    `json:"revision"`
+		Mapping  map[string]interface{} `json:"mapping"`
+	}
+
+	data, err := ioutil.ReadFile(s.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	err = json.Unmarshal(data, &stored)
+	if err != nil {
+		return err
+	}
+
+	for id, sm := range stored {
+		g := graph.New()
+
+		err = g.Load(sm.Mapping)
+		if err != nil {
+			return err
+		}
+
+		s.mappings[id] = &storedMapping{Revision: sm.Revision, Mapping: g}
+	}
+
+	return nil
+}
+
+// write : atomically replaces the file on disk with all current mappings
+func (s *FileStore) write() error {
+	data, err := json.Marshal(s.mappings)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(s.path), filepath.Base(s.path))
+	if err != nil {
+		return err
+	}
+
+	_, err = tmp.Write(data)
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		_ = os.Remove(tmp.Name())
+		return err
+	}
+
+	return os.Rename(tmp.Name(), s.path)
+}
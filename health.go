@@ -0,0 +1,131 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package main
+
+import (
+	"net/http"
+	"os"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/nats-io/go-nats"
+)
+
+// DEFAULTMAXPENDING : number of messages waiting to be processed
+// above which the scheduler is not ready to receive more
+const DEFAULTMAXPENDING = 10000
+
+// storeRoundTrip : time of the last successful request to service-store
+var storeRoundTrip atomic.Value
+
+// Health : state of the connections the scheduler depends on
+type Health struct {
+	Status             string     `json:"status"`
+	NATS               string     `json:"nats"`
+	Subscribed         bool       `json:"subscribed"`
+	Pending            int        `json:"pending"`
+	LastStoreRoundTrip *time.Time `json:"last_store_round_trip,omitempty"`
+	InFlightBuilds     int        `json:"in_flight_builds"`
+}
+
+// maxPending : gets the maximum number of pending messages from the environment
+func maxPending() int {
+	v := os.Getenv("SCHEDULER_MAX_PENDING")
+	if v == "" {
+		return DEFAULTMAXPENDING
+	}
+
+	max, err := strconv.Atoi(v)
+	if err != nil {
+		logger.Error("invalid maximum of pending messages: " + v)
+		return DEFAULTMAXPENDING
+	}
+
+	return max
+}
+
+// natsStatus : name of the status of a nats connection
+func natsStatus(conn *nats.Conn) string {
+	if conn == nil {
+		return "disconnected"
+	}
+
+	switch conn.Status() {
+	case nats.CONNECTED:
+		return "connected"
+	case nats.CLOSED:
+		return "closed"
+	case nats.RECONNECTING:
+		return "reconnecting"
+	case nats.CONNECTING:
+		return "connecting"
+	}
+
+	return "disconnected"
+}
+
+// health : reports the state of the connections of the scheduler
+func (s *Subscriber) health() Health {
+	s.mu.Lock()
+	conn := s.conn
+	subs := s.subs
+	s.mu.Unlock()
+
+	h := Health{
+		NATS:           natsStatus(conn),
+		Subscribed:     len(subs) > 0,
+		Pending:        s.queue.Len(),
+		InFlightBuilds: s.active.Count(),
+	}
+
+	for _, sub := range subs {
+		if !sub.IsValid() {
+			h.Subscribed = false
+			continue
+		}
+
+		pending, _, err := sub.Pending()
+		if err == nil {
+			h.Pending += pending
+		}
+	}
+
+	if t, ok := storeRoundTrip.Load().(time.Time); ok {
+		h.LastStoreRoundTrip = &t
+	}
+
+	return h
+}
+
+// serveHealth : reports the scheduler as alive unless
+// its nats connection has been closed
+func (s *Subscriber) serveHealth(w http.ResponseWriter, r *http.Request) {
+	h := s.health()
+
+	if h.NATS == "closed" || h.NATS == "disconnected" {
+		h.Status = "unavailable"
+		writeJSON(w, http.StatusServiceUnavailable, h)
+		return
+	}
+
+	h.Status = "ok"
+	writeJSON(w, http.StatusOK, h)
+}
+
+// serveReady : reports the scheduler as ready when it is connected to
+// nats, subscribed, and not backlogged with pending messages
+func (s *Subscriber) serveReady(w http.ResponseWriter, r *http.Request) {
+	h := s.health()
+
+	if h.NATS != "connected" || !h.Subscribed || h.Pending > s.maxPending {
+		h.Status = "unavailable"
+		writeJSON(w, http.StatusServiceUnavailable, h)
+		return
+	}
+
+	h.Status = "ok"
+	writeJSON(w, http.StatusOK, h)
+}
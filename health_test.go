@@ -0,0 +1,50 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package main
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestHealth(t *testing.T) {
+	Convey("Given a scheduler that is not connected to nats", t, func() {
+		s := NewSubscriber(NewMemoryStore(), nil)
+		s.active.Add("test", "build.create")
+
+		now := time.Now().UTC()
+		storeRoundTrip.Store(now)
+
+		Convey("When checking if it is alive", func() {
+			var h Health
+			code := adminRequest(s.serveHealth, "/healthz", &h)
+
+			Convey("It should not be available", func() {
+				So(code, ShouldEqual, http.StatusServiceUnavailable)
+				So(h.Status, ShouldEqual, "unavailable")
+				So(h.NATS, ShouldEqual, "disconnected")
+			})
+		})
+
+		Convey("When checking if it is ready", func() {
+			var h Health
+			code := adminRequest(s.serveReady, "/readyz", &h)
+
+			Convey("It should not be ready", func() {
+				So(code, ShouldEqual, http.StatusServiceUnavailable)
+				So(h.Subscribed, ShouldBeFalse)
+			})
+
+			Convey("It should report the builds in flight and the last request to the store", func() {
+				So(h.InFlightBuilds, ShouldEqual, 1)
+				So(h.LastStoreRoundTrip, ShouldNotBeNil)
+				So(h.LastStoreRoundTrip.Equal(now), ShouldBeTrue)
+			})
+		})
+	})
+}
@@ -0,0 +1,179 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package main
+
+import (
+	"sort"
+	"time"
+
+	graph "gopkg.in/r3labs/graph.v2"
+)
+
+// SLOWESTCOMPONENTS : number of components reported as the slowest of a build
+const SLOWESTCOMPONENTS = 5
+
+// Timing : time a component has taken to run
+type Timing struct {
+	ID       string  `json:"_component_id"`
+	Duration float64 `json:"duration"`
+}
+
+// Summary : execution history of a build. Durations are in seconds
+type Summary struct {
+	StartedAt    string   `json:"started_at,omitempty"`
+	FinishedAt   string   `json:"finished_at,omitempty"`
+	Duration     float64  `json:"duration"`
+	CriticalPath []string `json:"critical_path"`
+	Slowest      []Timing `json:"slowest"`
+}
+
+// started : stamps when a component has been sent, and the subject it has
+// been sent to. Retried components keep the time they were first sent
+func started(c graph.Component, t time.Time) {
+	gc := c.(*graph.GenericComponent)
+
+	if _, ok := (*gc)["_started_at"]; !ok {
+		(*gc)["_started_at"] = t.UTC().Format(time.RFC3339Nano)
+	}
+	(*gc)["_subject"] = componentSubject(c)
+	delete(*gc, "_finished_at")
+}
+
+// finished : stamps when a received component has finished, keeping
+// the execution history and trace context recorded on its change
+func finished(change, c graph.Component, t time.Time) {
+	gc := c.(*graph.GenericComponent)
+
+	if change != nil {
+		gch := change.(*graph.GenericComponent)
+		for _, key := range []string{"_started_at", "_subject", "_attempts", "_trace", "_traceparent"} {
+			if _, ok := (*gc)[key]; !ok && (*gch)[key] != nil {
+				(*gc)[key] = (*gch)[key]
+			}
+		}
+	}
+
+	if c.GetState() == STATUSCOMPLETED || c.GetState() == STATUSERRORED {
+		(*gc)["_finished_at"] = t.UTC().Format(time.RFC3339Nano)
+	}
+}
+
+// getTime : gets a time stamped on a component
+func getTime(c graph.Component, key string) (time.Time, bool) {
+	gc, ok := c.(*graph.GenericComponent)
+	if !ok {
+		return time.Time{}, false
+	}
+
+	v, _ := (*gc)[key].(string)
+
+	t, err := time.Parse(time.RFC3339Nano, v)
+	if err != nil {
+		return time.Time{}, false
+	}
+
+	return t, true
+}
+
+// duration : time a component has taken to run, or zero
+// if it has not finished
+func duration(c graph.Component) time.Duration {
+	start, ok := getTime(c, "_started_at")
+	if !ok {
+		return 0
+	}
+
+	end, ok := getTime(c, "_finished_at")
+	if !ok || end.Before(start) {
+		return 0
+	}
+
+	return end.Sub(start)
+}
+
+// Summary : summarizes the execution history of the build
+func (s Scheduler) Summary() Summary {
+	var first, last time.Time
+
+	summary := Summary{
+		CriticalPath: []string{},
+		Slowest:      []Timing{},
+	}
+
+	for _, c := range s.graph.Changes {
+		if t, ok := getTime(c, "_started_at"); ok && (first.IsZero() || t.Before(first)) {
+			first = t
+		}
+
+		if t, ok := getTime(c, "_finished_at"); ok && t.After(last) {
+			last = t
+		}
+
+		if d := duration(c); d > 0 {
+			summary.Slowest = append(summary.Slowest, Timing{ID: c.GetID(), Duration: d.Seconds()})
+		}
+	}
+
+	if !first.IsZero() && last.After(first) {
+		summary.StartedAt = first.Format(time.RFC3339Nano)
+		summary.FinishedAt = last.Format(time.RFC3339Nano)
+		summary.Duration = last.Sub(first).Seconds()
+	}
+
+	sort.SliceStable(summary.Slowest, func(i, j int) bool {
+		return summary.Slowest[i].Duration > summary.Slowest[j].Duration
+	})
+
+	if len(summary.Slowest) > SLOWESTCOMPONENTS {
+		summary.Slowest = summary.Slowest[:SLOWESTCOMPONENTS]
+	}
+
+	durations := make(map[string]time.Duration)
+	next := make(map[string]string)
+	s.pathDuration("start", durations, next, make(map[string]bool))
+
+	for id := next["start"]; id != "" && id != "end"; id = next[id] {
+		summary.CriticalPath = append(summary.CriticalPath, id)
+	}
+
+	return summary
+}
+
+// pathDuration : time taken by the slowest path from a component to the
+// end of the graph. The next component on that path is kept on next
+func (s Scheduler) pathDuration(id string, durations map[string]time.Duration, next map[string]string, visiting map[string]bool) time.Duration {
+	var longest time.Duration
+
+	if d, ok := durations[id]; ok {
+		return d
+	}
+
+	// cycles are not followed
+	if visiting[id] {
+		return 0
+	}
+	visiting[id] = true
+
+	for _, edge := range s.graph.Edges {
+		if edge.Source != id {
+			continue
+		}
+
+		d := s.pathDuration(edge.Destination, durations, next, visiting)
+		if _, ok := next[id]; !ok || d > longest {
+			longest = d
+			next[id] = edge.Destination
+		}
+	}
+
+	if c := s.graph.ComponentAll(id); c != nil {
+		longest = longest + duration(c)
+	}
+
+	delete(visiting, id)
+	durations[id] = longest
+
+	return longest
+}
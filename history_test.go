@@ -0,0 +1,95 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package main
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+	graph "gopkg.in/r3labs/graph.v2"
+)
+
+func stamp(g *graph.Graph, id string, start time.Time, d time.Duration) {
+	c := g.ComponentAll(id)
+	c.SetState(STATUSRUNNING)
+	started(c, start)
+	c.SetState(STATUSCOMPLETED)
+	finished(nil, c, start.Add(d))
+}
+
+func TestHistory(t *testing.T) {
+	Convey("Given a component", t, func() {
+		now := time.Now()
+		c := graph.GenericComponent{
+			"_component_id": "instance::web-1",
+			"_component":    "instance",
+			"_action":       "create",
+			"_provider":     "aws",
+			"_state":        STATUSRUNNING,
+		}
+
+		Convey("When it is sent", func() {
+			started(&c, now)
+
+			Convey("It should record when and where it has been sent", func() {
+				So(c["_started_at"], ShouldEqual, now.UTC().Format(time.RFC3339Nano))
+				So(c["_subject"], ShouldEqual, "instance.create.aws")
+			})
+
+			Convey("It should keep the time it was first sent when it is retried", func() {
+				started(&c, now.Add(time.Minute))
+				So(c["_started_at"], ShouldEqual, now.UTC().Format(time.RFC3339Nano))
+			})
+		})
+
+		Convey("When it is received", func() {
+			change := graph.GenericComponent{
+				"_component_id": "instance::web-1",
+				"_started_at":   now.UTC().Format(time.RFC3339Nano),
+				"_subject":      "instance.create.aws",
+				"_attempts":     2,
+			}
+			c["_state"] = STATUSCOMPLETED
+			finished(&change, &c, now.Add(time.Minute))
+
+			Convey("It should keep the history of its change and record when it has finished", func() {
+				So(c["_started_at"], ShouldEqual, change["_started_at"])
+				So(c["_subject"], ShouldEqual, "instance.create.aws")
+				So(c["_attempts"], ShouldEqual, 2)
+				So(duration(&c), ShouldEqual, time.Minute)
+			})
+		})
+	})
+
+	Convey("Given a build that has finished", t, func() {
+		s := Scheduler{graph: loadTestMapping("test")}
+		now := time.Now()
+
+		stamp(s.graph, "instance::db-1", now, time.Minute)
+		stamp(s.graph, "instance::db-2", now.Add(time.Minute), 2*time.Minute)
+		stamp(s.graph, "network::web-new", now, 30*time.Second)
+		stamp(s.graph, "instance::web-new-1", now.Add(30*time.Second), 45*time.Second)
+
+		Convey("When summarizing it", func() {
+			summary := s.Summary()
+
+			Convey("It should report its duration", func() {
+				So(summary.Duration, ShouldEqual, 180)
+			})
+
+			Convey("It should report its critical path", func() {
+				So(summary.CriticalPath, ShouldResemble, []string{"instance::db-1", "instance::db-2"})
+			})
+
+			Convey("It should report its slowest components", func() {
+				So(summary.Slowest, ShouldHaveLength, 4)
+				So(summary.Slowest[0].ID, ShouldEqual, "instance::db-2")
+				So(summary.Slowest[0].Duration, ShouldEqual, 120)
+				So(summary.Slowest[1].ID, ShouldEqual, "instance::db-1")
+			})
+		})
+	})
+}
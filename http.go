@@ -0,0 +1,66 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package main
+
+import (
+	"net/http"
+	"os"
+)
+
+// DEFAULTHTTPADDR : address the http server listens on by default
+const DEFAULTHTTPADDR = ":9100"
+
+// DEFAULTADMINADDR : address the admin api listens on by default,
+// only reachable from the host the scheduler runs on
+const DEFAULTADMINADDR = "127.0.0.1:9101"
+
+// httpAddr : gets the address of the http server from the environment
+func httpAddr() string {
+	addr := os.Getenv("SCHEDULER_HTTP_ADDR")
+	if addr == "" {
+		return DEFAULTHTTPADDR
+	}
+
+	return addr
+}
+
+// adminAddr : gets the address of the admin api from the environment
+func adminAddr() string {
+	addr := os.Getenv("SCHEDULER_ADMIN_ADDR")
+	if addr == "" {
+		return DEFAULTADMINADDR
+	}
+
+	return addr
+}
+
+// serve : starts the http server, exposing the metrics and health of the scheduler
+func serve(addr string, s *Subscriber) {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", metrics)
+	mux.HandleFunc("/healthz", s.serveHealth)
+	mux.HandleFunc("/readyz", s.serveReady)
+
+	listenHTTP("http server", addr, mux)
+}
+
+// serveAdmin : starts the admin api, exposing the state of the builds in progress
+func serveAdmin(addr string, s *Subscriber) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/builds", s.serveBuilds)
+	mux.HandleFunc("/builds/", s.serveBuild)
+
+	listenHTTP("admin api", addr, mux)
+}
+
+// listenHTTP : serves http requests on an address until the server stops
+func listenHTTP(name, addr string, handler http.Handler) {
+	logger.With(Fields{"addr": addr}).Info(name + " listening")
+
+	err := http.ListenAndServe(addr, handler)
+	if err != nil {
+		logger.Error(name + " has stopped: " + err.Error())
+	}
+}
@@ -0,0 +1,171 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nats-io/go-nats"
+)
+
+// JETSTREAMMAXDELIVER : times a component result is delivered
+// before it is given up when it can not be processed
+const JETSTREAMMAXDELIVER = 60
+
+// JETSTREAMREDELIVERY : time to wait before a component result
+// that could not be processed is delivered again
+const JETSTREAMREDELIVERY = 5 * time.Second
+
+// JETSTREAMAPITIMEOUT : time to wait for a reply of the JetStream api
+const JETSTREAMAPITIMEOUT = 5 * time.Second
+
+// JETSTREAMDELIVERPREFIX : prefix of the subjects durable consumers deliver to
+const JETSTREAMDELIVERPREFIX = "scheduler.jetstream."
+
+// ErrPartitionedJetStream : returned when durable consumers are used along
+// with several partitions, as forwarded results would not be durable
+var ErrPartitionedJetStream = errors.New("durable consumers can not be used with several partitions")
+
+// ErrNoStream : returned when no JetStream stream captures a subject
+var ErrNoStream = errors.New("no stream captures the subject")
+
+// JetStream : consumes the results of components from a JetStream stream with
+// durable consumers, so results published while the scheduler is not running
+// are delivered once it starts again. A result is only acknowledged once it
+// has been stored and its dependants dispatched, and is delivered again otherwise.
+// The JetStream api is used over the nats connection of the scheduler, so it
+// shares its credentials and tls settings
+type JetStream struct {
+	durable string
+}
+
+// jsReply : reply of the JetStream api
+type jsReply struct {
+	Streams []string `json:"streams"`
+	Error   *struct {
+		Code        int    `json:"code"`
+		Description string `json:"description"`
+	} `json:"error"`
+}
+
+// jetStream : gets the name of the durable consumers from the environment.
+// Results are consumed over core nats unless SCHEDULER_JETSTREAM_DURABLE is set
+func jetStream() *JetStream {
+	durable := os.Getenv("SCHEDULER_JETSTREAM_DURABLE")
+	if durable == "" {
+		return nil
+	}
+
+	return &JetStream{durable: durable}
+}
+
+// Subscribe : creates a durable consumer of a subject on the stream that captures
+// it, and subscribes to the subject it delivers to. Messages are handled along
+// with the function that acknowledges them once processed
+func (j *JetStream) Subscribe(conn *nats.Conn, subject string, handler func(*nats.Msg, func(bool))) (*nats.Subscription, error) {
+	stream, err := j.stream(conn, subject)
+	if err != nil {
+		return nil, err
+	}
+
+	name := durableName(j.durable, subject)
+
+	data, err := json.Marshal(map[string]interface{}{
+		"stream_name": stream,
+		"config": map[string]interface{}{
+			"durable_name":    name,
+			"deliver_subject": JETSTREAMDELIVERPREFIX + name,
+			"deliver_policy":  "all",
+			"ack_policy":      "explicit",
+			"max_deliver":     JETSTREAMMAXDELIVER,
+			"filter_subject":  subject,
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = jsRequest(conn, "$JS.API.CONSUMER.DURABLE.CREATE."+stream+"."+name, data)
+	if err != nil {
+		return nil, err
+	}
+
+	return conn.Subscribe(JETSTREAMDELIVERPREFIX+name, func(msg *nats.Msg) {
+		handler(msg, func(processed bool) {
+			acknowledge(msg, processed)
+		})
+	})
+}
+
+// stream : finds the name of the stream that captures a subject
+func (j *JetStream) stream(conn *nats.Conn, subject string) (string, error) {
+	data, err := json.Marshal(map[string]string{"subject": subject})
+	if err != nil {
+		return "", err
+	}
+
+	r, err := jsRequest(conn, "$JS.API.STREAM.NAMES", data)
+	if err != nil {
+		return "", err
+	}
+
+	if len(r.Streams) < 1 {
+		return "", ErrNoStream
+	}
+
+	return r.Streams[0], nil
+}
+
+// jsRequest : sends a request to the JetStream api and parses its reply
+func jsRequest(conn *nats.Conn, subject string, data []byte) (*jsReply, error) {
+	msg, err := conn.Request(subject, data, JETSTREAMAPITIMEOUT)
+	if err != nil {
+		return nil, err
+	}
+
+	var r jsReply
+
+	err = json.Unmarshal(msg.Data, &r)
+	if err != nil {
+		return nil, err
+	}
+
+	if r.Error != nil {
+		return nil, errors.New(r.Error.Description)
+	}
+
+	return &r, nil
+}
+
+// acknowledge : acknowledges a message that has been processed, or
+// asks for it to be delivered again if it could not be processed
+func acknowledge(msg *nats.Msg, processed bool) {
+	ack := []byte("+ACK")
+	if !processed {
+		ack = []byte(`-NAK {"delay": ` + strconv.FormatInt(int64(JETSTREAMREDELIVERY), 10) + `}`)
+	}
+
+	if err := publish(msg.Reply, ack); err != nil {
+		logger.With(Fields{"subject": msg.Subject}).Error("could not acknowledge message: " + err.Error())
+	}
+}
+
+// durableName : name of the durable consumer of a subject, as
+// durable names can not contain dots or wildcards
+func durableName(durable, subject string) string {
+	r := strings.NewReplacer(".", "_", "*", "all", ">", "rest")
+
+	return durable + "_" + r.Replace(subject)
+}
+
+// componentResults : returns true if a subject only carries component results
+func componentResults(subject string) bool {
+	return strings.HasSuffix(subject, ".done") || strings.HasSuffix(subject, ".error")
+}
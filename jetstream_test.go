@@ -0,0 +1,56 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package main
+
+import (
+	"testing"
+
+	"github.com/nats-io/go-nats"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestJetStream(t *testing.T) {
+	Convey("Given the subjects of the scheduler", t, func() {
+		Convey("When getting the durable consumer of a subject", func() {
+			name := durableName("scheduler", "*.*.aws.done")
+
+			Convey("It should not contain dots or wildcards", func() {
+				So(name, ShouldEqual, "scheduler_all_all_aws_done")
+			})
+		})
+
+		Convey("When checking which subjects carry component results", func() {
+			Convey("It should only consume component results from durable consumers", func() {
+				So(componentResults("*.*.aws.done"), ShouldBeTrue)
+				So(componentResults("*.*.*.error"), ShouldBeTrue)
+				So(componentResults("build.*"), ShouldBeFalse)
+				So(componentResults("scheduler.graph.render"), ShouldBeFalse)
+			})
+		})
+
+		Convey("When acknowledging a durable message", func() {
+			var acks []string
+
+			original := publish
+			publish = func(subject string, data []byte) error {
+				acks = append(acks, subject+" "+string(data))
+				return nil
+			}
+			defer func() { publish = original }()
+
+			msg := &nats.Msg{Subject: "instance.create.aws.done", Reply: "$JS.ACK.results.scheduler.1.1.1"}
+			acknowledge(msg, true)
+			acknowledge(msg, false)
+
+			Convey("It should reply to the message, asking for it to be delivered again if it was not processed", func() {
+				So(acks, ShouldResemble, []string{
+					"$JS.ACK.results.scheduler.1.1.1 +ACK",
+					`$JS.ACK.results.scheduler.1.1.1 -NAK {"delay": 5000000000}`,
+				})
+			})
+		})
+	})
+}
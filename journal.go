@@ -0,0 +1,379 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	graph "gopkg.in/r3labs/graph.v2"
+)
+
+const (
+	// JOURNALSTARTED : a build has been received
+	JOURNALSTARTED = "started"
+	// JOURNALTRANSITION : the state of a component has changed
+	JOURNALTRANSITION = "transition"
+	// JOURNALSENT : a component has been sent
+	JOURNALSENT = "sent"
+	// JOURNALFINISHED : a build has completed or errored
+	JOURNALFINISHED = "finished"
+)
+
+// JournalEntry : a single record of the journal
+type JournalEntry struct {
+	Time      time.Time              `json:"time"`
+	Type      string                 `json:"type"`
+	Service   string                 `json:"service"`
+	Component string                 `json:"component,omitempty"`
+	State     string                 `json:"state,omitempty"`
+	Subject   string                 `json:"subject,omitempty"`
+	Data      map[string]interface{} `json:"data,omitempty"`
+}
+
+// BuildRecord : the state of a build as recorded by the journal
+type BuildRecord struct {
+	Finished    bool
+	Sent        map[string]time.Time
+	Transitions map[string]JournalEntry
+	entries     []JournalEntry
+}
+
+// Journal : local append-only log of the state transitions and
+// dispatched components of every build, used to recover in-flight
+// builds when the scheduler is restarted
+type Journal struct {
+	mu   sync.Mutex
+	path string
+	file *os.File
+}
+
+// NewJournal : Journal constructor, opens or creates the journal file
+func NewJournal(path string) (*Journal, error) {
+	j := &Journal{path: path}
+
+	return j, j.open()
+}
+
+func (j *Journal) open() error {
+	var err error
+
+	j.file, err = os.OpenFile(j.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+
+	return err
+}
+
+// Started : records a build has been received
+func (j *Journal) Started(service string) {
+	j.append(JournalEntry{Type: JOURNALSTARTED, Service: service})
+}
+
+// Transition : records the state of a component has changed. Only the
+// results of components are recorded along with the component, as they
+// are the only transitions stored again when recovering a build
+func (j *Journal) Transition(service string, c graph.Component) {
+	e := JournalEntry{
+		Type:      JOURNALTRANSITION,
+		Service:   service,
+		Component: c.GetID(),
+		State:     c.GetState(),
+	}
+
+	if e.State == STATUSCOMPLETED || e.State == STATUSERRORED {
+		e.Data = *c.(*graph.GenericComponent)
+	}
+
+	j.append(e)
+}
+
+// Sent : records a component has been sent
+func (j *Journal) Sent(service string, c graph.Component) {
+	j.append(JournalEntry{
+		Type:      JOURNALSENT,
+		Service:   service,
+		Component: c.GetID(),
+		Subject:   componentSubject(c),
+	})
+}
+
+// Finished : records a build has completed or errored, and compacts
+// the journal so it only grows with the builds in flight
+func (j *Journal) Finished(service string) {
+	if j == nil {
+		return
+	}
+
+	j.append(JournalEntry{Type: JOURNALFINISHED, Service: service})
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	builds, err := j.replay()
+	if err == nil {
+		err = j.compact(builds)
+	}
+
+	if err != nil {
+		serviceLog(service).Error("could not compact journal: " + err.Error())
+	}
+}
+
+// append : writes an entry to the journal and syncs it to disk.
+// A nil journal discards all entries
+func (j *Journal) append(e JournalEntry) {
+	if j == nil {
+		return
+	}
+
+	e.Time = time.Now().UTC()
+
+	data, err := json.Marshal(e)
+	if err != nil {
+		serviceLog(e.Service).Error("could not journal entry: " + err.Error())
+		return
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	_, err = j.file.Write(append(data, '\n'))
+	if err == nil {
+		err = j.file.Sync()
+	}
+
+	if err != nil {
+		serviceLog(e.Service).Error("could not journal entry: " + err.Error())
+	}
+}
+
+// Replay : reads the journal and returns the recorded state of every build
+func (j *Journal) Replay() (map[string]*BuildRecord, error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	return j.replay()
+}
+
+func (j *Journal) replay() (map[string]*BuildRecord, error) {
+	builds := make(map[string]*BuildRecord)
+
+	f, err := os.Open(j.path)
+	if err != nil {
+		return builds, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 64*1024*1024)
+
+	for scanner.Scan() {
+		var e JournalEntry
+
+		// a partially written entry is expected if the scheduler
+		// stopped while appending to the journal
+		if json.Unmarshal(scanner.Bytes(), &e) != nil {
+			continue
+		}
+
+		b, ok := builds[e.Service]
+		if !ok || e.Type == JOURNALSTARTED {
+			b = &BuildRecord{
+				Sent:        make(map[string]time.Time),
+				Transitions: make(map[string]JournalEntry),
+			}
+			builds[e.Service] = b
+		}
+
+		b.entries = append(b.entries, e)
+
+		switch e.Type {
+		case JOURNALTRANSITION:
+			b.Transitions[e.Component] = e
+		case JOURNALSENT:
+			b.Sent[e.Component] = e.Time
+		case JOURNALFINISHED:
+			b.Finished = true
+		}
+	}
+
+	return builds, scanner.Err()
+}
+
+// Compact : rewrites the journal keeping only the entries
+// of the builds that have not finished
+func (j *Journal) Compact(builds map[string]*BuildRecord) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	return j.compact(builds)
+}
+
+func (j *Journal) compact(builds map[string]*BuildRecord) error {
+	tmp, err := ioutil.TempFile(filepath.Dir(j.path), filepath.Base(j.path))
+	if err != nil {
+		return err
+	}
+
+	w := bufio.NewWriter(tmp)
+	for _, b := range builds {
+		if b.Finished {
+			continue
+		}
+
+		for _, e := range b.entries {
+			data, merr := json.Marshal(e)
+			if merr != nil {
+				err = merr
+				break
+			}
+			_, _ = w.Write(append(data, '\n'))
+		}
+	}
+
+	if err == nil {
+		err = w.Flush()
+	}
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		_ = os.Remove(tmp.Name())
+		return err
+	}
+
+	err = os.Rename(tmp.Name(), j.path)
+	if err != nil {
+		return err
+	}
+
+	_ = j.file.Close()
+
+	return j.open()
+}
+
+// Recover : replays the journal and resumes every build that was
+// in flight when the scheduler stopped
+func (s *Subscriber) Recover() error {
+	if s.journal == nil {
+		return nil
+	}
+
+	builds, err := s.journal.Replay()
+	if err != nil {
+		return err
+	}
+
+	// finished builds are discarded before any new entry is recorded
+	err = s.journal.Compact(builds)
+	if err != nil {
+		return err
+	}
+
+	for id, b := range builds {
+		if b.Finished {
+			continue
+		}
+
+		serviceLog(id).Info("recovering build")
+		s.active.Add(id, "")
+
+		err = s.recoverBuild(id, b)
+		if err != nil {
+			serviceLog(id).Error("could not recover build: " + err.Error())
+		}
+	}
+
+	return nil
+}
+
+// recoverBuild : brings the stored mapping of a build up to date with the
+// journal, and dispatches all components that were left unsent
+func (s *Subscriber) recoverBuild(id string, b *BuildRecord) error {
+	var scheduler Scheduler
+	var next []graph.Component
+
+	mapping, err := s.store.GetMapping(id)
+	if err != nil {
+		return err
+	}
+
+	scheduler.graph = graph.New()
+	scheduler.revision = getRevision(mapping)
+	scheduler.slots = s.slots
+
+	err = scheduler.graph.Load(mapping)
+	if err != nil {
+		return err
+	}
+
+	// apply any result that was received but never stored
+	for _, t := range b.Transitions {
+		c := scheduler.graph.ComponentAll(t.Component)
+		if c == nil || c.GetState() == t.State {
+			continue
+		}
+
+		if t.State != STATUSCOMPLETED && t.State != STATUSERRORED {
+			continue
+		}
+
+		rc := graph.MapGenericComponent(t.Data)
+
+		err = s.storeComponent(&scheduler, rc)
+		if err != nil {
+			return err
+		}
+
+		cs, _ := scheduler.Receive(rc)
+		next = append(next, cs...)
+	}
+
+	// resend components that were marked as running but never sent
+	for _, c := range scheduler.graph.Changes {
+		if c.GetState() != STATUSRUNNING || contains(next, c) {
+			continue
+		}
+
+		s.slots.Hold(id, c)
+
+		sent, ok := b.Sent[c.GetID()]
+		if ok {
+			s.timeouts.Start(id, c, sent)
+		} else {
+			next = append(next, c)
+		}
+	}
+
+	// schedule any component whose dependencies are now satisfied
+	next = append(next, scheduler.Unblocked()...)
+
+	err = s.dispatch(&scheduler, next, false)
+	if err != nil {
+		return err
+	}
+
+	s.finish(&scheduler)
+
+	return nil
+}
+
+// contains : returns true if a component is part of a collection
+func contains(cs []graph.Component, c graph.Component) bool {
+	for _, o := range cs {
+		if o.GetID() == c.GetID() {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,164 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+	graph "gopkg.in/r3labs/graph.v2"
+)
+
+func TestJournal(t *testing.T) {
+	Convey("Given a journal", t, func() {
+		dir, err := ioutil.TempDir("", "scheduler")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+
+		path := filepath.Join(dir, "scheduler.journal")
+
+		j, err := NewJournal(path)
+		So(err, ShouldBeNil)
+
+		Convey("When the progress of several builds is recorded", func() {
+			j.Started("service-1")
+			j.Transition("service-1", serviceComponent("network::web-new", "service-1", STATUSRUNNING))
+			j.Sent("service-1", serviceComponent("network::web-new", "service-1", STATUSRUNNING))
+			j.Transition("service-1", serviceComponent("network::web-new", "service-1", STATUSCOMPLETED))
+			j.Transition("service-1", serviceComponent("instance::web-new-1", "service-1", STATUSRUNNING))
+
+			j.Started("service-2")
+			j.Transition("service-2", serviceComponent("network::web-new", "service-2", STATUSRUNNING))
+			j.Finished("service-2")
+
+			builds, err := j.Replay()
+
+			Convey("It should return the recorded state of every build in flight", func() {
+				So(err, ShouldBeNil)
+				So(builds["service-1"].Finished, ShouldBeFalse)
+				So(builds["service-1"].Sent["network::web-new"], ShouldNotBeZeroValue)
+				So(builds["service-1"].Sent["instance::web-new-1"], ShouldBeZeroValue)
+				So(builds["service-1"].Transitions["network::web-new"].State, ShouldEqual, STATUSCOMPLETED)
+			})
+
+			Convey("It should only record the components of their results", func() {
+				So(builds["service-1"].Transitions["network::web-new"].Data, ShouldNotBeNil)
+				So(builds["service-1"].Transitions["instance::web-new-1"].Data, ShouldBeNil)
+			})
+
+			Convey("It should discard the builds that have finished", func() {
+				So(len(builds), ShouldEqual, 1)
+				So(builds["service-2"], ShouldBeNil)
+			})
+
+			Convey("And the journal is compacted", func() {
+				So(j.Compact(builds), ShouldBeNil)
+				j.Sent("service-1", serviceComponent("instance::web-new-1", "service-1", STATUSRUNNING))
+
+				builds, err := j.Replay()
+
+				Convey("It should only keep the builds that have not finished", func() {
+					So(err, ShouldBeNil)
+					So(len(builds), ShouldEqual, 1)
+					So(builds["service-1"].Sent["network::web-new"], ShouldNotBeZeroValue)
+					So(builds["service-1"].Sent["instance::web-new-1"], ShouldNotBeZeroValue)
+				})
+			})
+		})
+
+		Convey("When a build is started again", func() {
+			j.Started("service-1")
+			j.Sent("service-1", serviceComponent("network::web-new", "service-1", STATUSRUNNING))
+			j.Finished("service-1")
+			j.Started("service-1")
+
+			builds, err := j.Replay()
+
+			Convey("It should only return the state of the latest build", func() {
+				So(err, ShouldBeNil)
+				So(builds["service-1"].Finished, ShouldBeFalse)
+				So(len(builds["service-1"].Sent), ShouldEqual, 0)
+			})
+		})
+	})
+}
+
+func TestRecover(t *testing.T) {
+	Convey("Given a build that was in flight when the scheduler stopped", t, func() {
+		messages, restore := capturePublished()
+		Reset(restore)
+
+		dir, err := ioutil.TempDir("", "scheduler")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+
+		j, err := NewJournal(filepath.Join(dir, "scheduler.journal"))
+		So(err, ShouldBeNil)
+
+		g := loadTestMapping("test")
+		for _, c := range g.Changes {
+			(*c.(*graph.GenericComponent))["service"] = g.ID
+		}
+		g.ComponentAll("instance::db-1").SetState(STATUSRUNNING)
+		g.ComponentAll("network::web-new").SetState(STATUSRUNNING)
+		for _, id := range []string{"instance::web-1", "instance::web-2", "instance::web-3"} {
+			g.ComponentAll(id).SetState(STATUSRUNNING)
+		}
+
+		store := NewMemoryStore()
+		_, err = store.SetMapping(g.ID, g, 0)
+		So(err, ShouldBeNil)
+
+		s := NewSubscriber(store, j)
+		Reset(func() {
+			for _, c := range g.Changes {
+				s.timeouts.Stop(g.ID, c.GetID())
+			}
+		})
+
+		// db-1 completed but its result was never stored, network::web-new
+		// was never sent, and the instances to delete were sent
+		j.Started(g.ID)
+		for _, c := range g.Changes {
+			if c.GetState() == STATUSRUNNING {
+				j.Transition(g.ID, c)
+			}
+		}
+		for _, id := range []string{"instance::db-1", "instance::web-1", "instance::web-2", "instance::web-3"} {
+			j.Sent(g.ID, g.ComponentAll(id))
+		}
+
+		completed := cp(g.ComponentAll("instance::db-1"))
+		completed.SetState(STATUSCOMPLETED)
+		j.Transition(g.ID, completed)
+
+		Convey("When the scheduler recovers it", func() {
+			So(s.Recover(), ShouldBeNil)
+
+			sent := make(map[string]int)
+			for len(messages) > 0 {
+				m := <-messages
+				id, _ := m.data["_component_id"].(string)
+				sent[id]++
+			}
+
+			Convey("It should store the results that were not stored", func() {
+				So(storedChange(store, g.ID, "instance::db-1").GetState(), ShouldEqual, STATUSCOMPLETED)
+			})
+
+			Convey("It should send the components that were never sent, and their dependants", func() {
+				So(sent, ShouldResemble, map[string]int{"network::web-new": 1, "instance::db-2": 1})
+				So(storedChange(store, g.ID, "instance::db-2").GetState(), ShouldEqual, STATUSRUNNING)
+			})
+
+			Convey("It should keep tracking the build", func() {
+				So(s.active.Count(), ShouldEqual, 1)
+			})
+		})
+	})
+}
@@ -0,0 +1,191 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	graph "gopkg.in/r3labs/graph.v2"
+)
+
+const (
+	// LOGDEBUG : debug log level
+	LOGDEBUG = iota
+	// LOGINFO : info log level
+	LOGINFO
+	// LOGWARN : warn log level
+	LOGWARN
+	// LOGERROR : error log level
+	LOGERROR
+)
+
+var levelNames = []string{"debug", "info", "warn", "error"}
+
+var logger = NewLogger(os.Stderr, os.Getenv("SCHEDULER_LOG_LEVEL"), os.Getenv("SCHEDULER_LOG_FORMAT"))
+
+// Fields : fields attached to a log entry
+type Fields map[string]interface{}
+
+// output : destination of log entries, shared by all derived loggers
+type output struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// Logger : writes leveled log entries, with a set of fields
+// attached to them, as text or as json
+type Logger struct {
+	out    *output
+	level  int
+	json   bool
+	fields Fields
+}
+
+// NewLogger : Logger constructor. The level defaults to info
+// and the format to text
+func NewLogger(w io.Writer, level, format string) *Logger {
+	l := &Logger{
+		out:   &output{w: w},
+		level: LOGINFO,
+		json:  strings.ToLower(format) == "json",
+	}
+
+	for i, name := range levelNames {
+		if strings.ToLower(level) == name {
+			l.level = i
+		}
+	}
+
+	return l
+}
+
+// With : returns a logger that attaches the given fields to all of its entries
+func (l *Logger) With(fields Fields) *Logger {
+	merged := make(Fields, len(l.fields)+len(fields))
+	for k, v := range l.fields {
+		merged[k] = v
+	}
+	for k, v := range fields {
+		if v != nil && v != "" {
+			merged[k] = v
+		}
+	}
+
+	return &Logger{out: l.out, level: l.level, json: l.json, fields: merged}
+}
+
+// Debug : logs a debug entry
+func (l *Logger) Debug(msg string) {
+	l.write(LOGDEBUG, msg)
+}
+
+// Info : logs an info entry
+func (l *Logger) Info(msg string) {
+	l.write(LOGINFO, msg)
+}
+
+// Warn : logs a warning entry
+func (l *Logger) Warn(msg string) {
+	l.write(LOGWARN, msg)
+}
+
+// Error : logs an error entry
+func (l *Logger) Error(msg string) {
+	l.write(LOGERROR, msg)
+}
+
+// Fatal : logs an error entry and exits
+func (l *Logger) Fatal(msg string) {
+	l.write(LOGERROR, msg)
+	os.Exit(1)
+}
+
+func (l *Logger) write(level int, msg string) {
+	if level < l.level {
+		return
+	}
+
+	entry := make(Fields, len(l.fields)+3)
+	for k, v := range l.fields {
+		entry[k] = v
+	}
+	entry["time"] = time.Now().UTC().Format(time.RFC3339Nano)
+	entry["level"] = levelNames[level]
+	entry["msg"] = msg
+
+	var line []byte
+	if l.json {
+		line, _ = json.Marshal(entry)
+	} else {
+		line = []byte(text(entry))
+	}
+
+	l.out.mu.Lock()
+	defer l.out.mu.Unlock()
+
+	l.out.w.Write(append(line, '\n'))
+}
+
+// text : formats an entry as key=value pairs, starting with its
+// time, level and message, followed by all other fields sorted by key
+func text(entry Fields) string {
+	var keys []string
+	for k := range entry {
+		if k != "time" && k != "level" && k != "msg" {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+
+	pairs := []string{"time=" + entry["time"].(string), "level=" + entry["level"].(string), "msg=" + strconv.Quote(entry["msg"].(string))}
+	for _, k := range keys {
+		v, _ := json.Marshal(entry[k])
+		pairs = append(pairs, k+"="+string(v))
+	}
+
+	return strings.Join(pairs, " ")
+}
+
+// serviceLog : logger for the entries of a service
+func serviceLog(id string) *Logger {
+	return logger.With(Fields{"service_id": id})
+}
+
+// componentLog : logger for the entries of a component
+func componentLog(c graph.Component) *Logger {
+	gc, ok := c.(*graph.GenericComponent)
+	if !ok {
+		return logger
+	}
+
+	return logger.With(Fields{
+		"service_id":   (*gc)["service"],
+		"component_id": c.GetID(),
+		"action":       c.GetAction(),
+		"provider":     c.GetProvider(),
+	})
+}
+
+// messageLog : logger for the entries of a received message
+func messageLog(m *Message) *Logger {
+	l := logger.With(Fields{"subject": m.subject, "service_id": m.getServiceID()})
+
+	if m.getType() == COMPONENTYPE {
+		l = l.With(Fields{
+			"component_id": m.data["_component_id"],
+			"action":       m.data["_action"],
+			"provider":     m.data["_provider"],
+		})
+	}
+
+	return l
+}
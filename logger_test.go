@@ -0,0 +1,64 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+	graph "gopkg.in/r3labs/graph.v2"
+)
+
+func TestLogger(t *testing.T) {
+	Convey("Given a json logger", t, func() {
+		var buf bytes.Buffer
+		l := NewLogger(&buf, "warn", "json")
+
+		Convey("When logging an entry with fields", func() {
+			l.With(Fields{"service_id": "test", "subject": "build.create"}).Error("failed")
+
+			Convey("It should write the entry as json", func() {
+				var entry map[string]interface{}
+				So(json.Unmarshal(buf.Bytes(), &entry), ShouldBeNil)
+				So(entry["level"], ShouldEqual, "error")
+				So(entry["msg"], ShouldEqual, "failed")
+				So(entry["service_id"], ShouldEqual, "test")
+				So(entry["subject"], ShouldEqual, "build.create")
+			})
+		})
+
+		Convey("When logging an entry below its level", func() {
+			l.Info("received")
+
+			Convey("It should not write it", func() {
+				So(buf.Len(), ShouldEqual, 0)
+			})
+		})
+	})
+
+	Convey("Given a text logger", t, func() {
+		var buf bytes.Buffer
+		l := NewLogger(&buf, "", "")
+
+		Convey("When logging an entry for a component", func() {
+			c := graph.GenericComponent{
+				"_component_id": "instance::web-1",
+				"_action":       "create",
+				"_provider":     "aws",
+				"service":       "test",
+			}
+			old := logger
+			logger = l
+			componentLog(&c).Info("sending component")
+			logger = old
+
+			Convey("It should write the message followed by the component fields", func() {
+				So(buf.String(), ShouldContainSubstring, `level=info msg="sending component" action="create" component_id="instance::web-1" provider="aws" service_id="test"`)
+			})
+		})
+	})
+}
@@ -5,9 +5,9 @@
 package main
 
 import (
-	"log"
 	"os"
-	"runtime"
+	"os/signal"
+	"syscall"
 
 	ecc "github.com/ernestio/ernest-config-client"
 	"github.com/nats-io/go-nats"
@@ -20,9 +20,40 @@ func main() {
 	cfg = ecc.NewConfig(os.Getenv("NATS_URI"))
 	nc = cfg.Nats()
 
-	if _, err := nc.Subscribe(">", subscriber); err != nil {
-		log.Panic(err)
+	store, err := NewStore()
+	if err != nil {
+		logger.Fatal(err.Error())
 	}
 
-	runtime.Goexit()
+	var journal *Journal
+	if path := os.Getenv("SCHEDULER_JOURNAL"); path != "" {
+		journal, err = NewJournal(path)
+		if err != nil {
+			logger.Fatal(err.Error())
+		}
+	}
+
+	s := NewSubscriber(store, journal)
+
+	// the scheduler is alive while it recovers the builds in flight
+	s.Connect(nc)
+	go serve(httpAddr(), s)
+	go serveAdmin(adminAddr(), s)
+
+	if err := s.Recover(); err != nil {
+		logger.Error("could not recover builds: " + err.Error())
+	}
+
+	if err := s.Listen(nc); err != nil {
+		logger.Fatal(err.Error())
+	}
+
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, syscall.SIGINT, syscall.SIGTERM)
+
+	logger.Info("shutting down on " + (<-sig).String())
+
+	if err := s.Shutdown(shutdownTimeout()); err != nil {
+		logger.Fatal(err.Error())
+	}
 }
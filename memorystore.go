@@ -0,0 +1,220 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"sync"
+
+	graph "gopkg.in/r3labs/graph.v2"
+)
+
+// storedMapping : a mapping along with its current revision
+type storedMapping struct {
+	Revision int          `json:"revision"`
+	Mapping  *graph.Graph `json:"mapping"`
+}
+
+// MemoryStore : keeps all mappings in memory
+type MemoryStore struct {
+	mu       sync.Mutex
+	mappings map[string]*storedMapping
+	// save : called after every update, while the store is locked
+	save func() error
+}
+
+// NewMemoryStore : MemoryStore constructor
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		mappings: make(map[string]*storedMapping),
+	}
+}
+
+// GetMapping : gets the latest mapping of a service
+func (s *MemoryStore) GetMapping(id string) (map[string]interface{}, error) {
+	var mapping map[string]interface{}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sm, ok := s.mappings[id]
+	if !ok {
+		return mapping, ErrMappingNotFound
+	}
+
+	data, err := sm.Mapping.ToJSON()
+	if err != nil {
+		return mapping, err
+	}
+
+	err = json.Unmarshal(data, &mapping)
+	if err != nil {
+		return mapping, err
+	}
+
+	mapping["revision"] = sm.Revision
+
+	return mapping, nil
+}
+
+// SetMapping : stores the mapping of a service
+func (s *MemoryStore) SetMapping(id string, mapping *graph.Graph, revision int) (int, error) {
+	g, err := copyGraph(mapping)
+	if err != nil {
+		return revision, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sm, ok := s.mappings[id]
+	if !ok {
+		sm = &storedMapping{}
+		s.mappings[id] = sm
+	}
+
+	if revision != 0 && revision != sm.Revision {
+		return revision, ErrConflict
+	}
+
+	sm.Mapping = g
+
+	return s.commit(sm)
+}
+
+// SetComponent : stores a component on the mapping's components
+func (s *MemoryStore) SetComponent(c graph.Component, revision int) (int, error) {
+	return s.update(c, revision, func(g *graph.Graph, c graph.Component) error {
+		if g.Component(c.GetID()) == nil {
+			return g.AddComponent(c)
+		}
+
+		g.UpdateComponent(c)
+
+		return nil
+	})
+}
+
+// DeleteComponent : removes a component from the mapping's components
+func (s *MemoryStore) DeleteComponent(c graph.Component, revision int) (int, error) {
+	return s.update(c, revision, func(g *graph.Graph, c graph.Component) error {
+		g.DeleteComponent(c)
+		return nil
+	})
+}
+
+// SetChange : stores a component on the mapping's changes
+func (s *MemoryStore) SetChange(c graph.Component, revision int) (int, error) {
+	return s.update(c, revision, func(g *graph.Graph, c graph.Component) error {
+		for i := 0; i < len(g.Changes); i++ {
+			if g.Changes[i].GetID() == c.GetID() {
+				g.Changes[i] = c
+				return nil
+			}
+		}
+
+		g.Changes = append(g.Changes, c)
+
+		return nil
+	})
+}
+
+// DeleteChange : removes a component from the mapping's changes
+func (s *MemoryStore) DeleteChange(c graph.Component, revision int) (int, error) {
+	return s.update(c, revision, func(g *graph.Graph, c graph.Component) error {
+		for i := len(g.Changes) - 1; i >= 0; i-- {
+			if g.Changes[i].GetID() == c.GetID() {
+				g.Changes = append(g.Changes[:i], g.Changes[i+1:]...)
+			}
+		}
+
+		return nil
+	})
+}
+
+// update : applies an update to the mapping of the service the component
+// belongs to, if the mapping has not been modified since the given revision
+func (s *MemoryStore) update(c graph.Component, revision int, fn func(*graph.Graph, graph.Component) error) (int, error) {
+	cc, err := copyComponent(c)
+	if err != nil {
+		return revision, err
+	}
+
+	id, _ := (*cc)["service"].(string)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sm, ok := s.mappings[id]
+	if !ok {
+		return revision, ErrMappingNotFound
+	}
+
+	if revision != 0 && revision != sm.Revision {
+		return revision, ErrConflict
+	}
+
+	err = fn(sm.Mapping, cc)
+	if err != nil {
+		return revision, err
+	}
+
+	return s.commit(sm)
+}
+
+// commit : bumps the revision of an updated mapping
+func (s *MemoryStore) commit(sm *storedMapping) (int, error) {
+	sm.Revision++
+
+	if s.save != nil {
+		err := s.save()
+		if err != nil {
+			return sm.Revision, err
+		}
+	}
+
+	return sm.Revision, nil
+}
+
+// copyGraph : returns a copy of a graph that shares no state with it
+func copyGraph(g *graph.Graph) (*graph.Graph, error) {
+	var m map[string]interface{}
+
+	if g == nil {
+		return nil, errors.New("invalid mapping")
+	}
+
+	data, err := g.ToJSON()
+	if err != nil {
+		return nil, err
+	}
+
+	err = json.Unmarshal(data, &m)
+	if err != nil {
+		return nil, err
+	}
+
+	cg := graph.New()
+
+	return cg, cg.Load(m)
+}
+
+// copyComponent : returns a copy of a component that shares no state with it
+func copyComponent(c graph.Component) (*graph.GenericComponent, error) {
+	var m map[string]interface{}
+
+	data, err := json.Marshal(c)
+	if err != nil {
+		return nil, err
+	}
+
+	err = json.Unmarshal(data, &m)
+	if err != nil {
+		return nil, err
+	}
+
+	return graph.MapGenericComponent(m), nil
+}
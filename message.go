@@ -7,7 +7,6 @@ package main
 import (
 	"encoding/json"
 	"errors"
-	"log"
 	"strings"
 
 	graph "gopkg.in/r3labs/graph.v2"
@@ -18,13 +17,21 @@ const (
 	COMPONENTYPE = "component"
 	// SERVICETYPE : service type
 	SERVICETYPE = "service"
+	// CONTROLTYPE : control type, for messages that act on a build in progress
+	CONTROLTYPE = "control"
+	// PLANTYPE : plan type, for builds that are planned but not applied
+	PLANTYPE = "plan"
+	// RENDERTYPE : render type, for requests of the graph of a build
+	RENDERTYPE = "render"
 )
 
 // Message : Struct representing a received message, with
 // its endpoint as "subject" and the content as "data"
 type Message struct {
 	subject string
+	reply   string
 	data    map[string]interface{}
+	ack     func(bool)
 }
 
 // NewMessage : Message constructor
@@ -53,13 +60,13 @@ func NewFakeComponent(id string) *graph.GenericComponent {
 }
 
 // getGraph : will return the graph attached to the current message
-// or nil in case there is some problem
-func (m *Message) getGraph() *graph.Graph {
+// and its stored revision, or nil in case there is some problem
+func (m *Message) getGraph(store Store) (*graph.Graph, int) {
 	if m.getType() == SERVICETYPE {
-		return m.getGraphFromGraph()
+		return m.getGraphFromGraph(store)
 	}
 
-	return m.getGraphFromComponent()
+	return m.getGraphFromStore(store)
 }
 
 // getComponent : will get the graph current component
@@ -76,67 +83,97 @@ func (m *Message) getComponent() *graph.GenericComponent {
 	return component
 }
 
-func (m *Message) getGraphFromGraph() *graph.Graph {
+func (m *Message) getGraphFromGraph(store Store) (*graph.Graph, int) {
 	g := graph.New()
 
 	err := g.Load(m.data)
 	if err != nil {
-		log.Println("Error: could not load mapping!" + err.Error())
-		return nil
+		messageLog(m).Error("could not load mapping: " + err.Error())
+		return nil, 0
 	}
 
 	g.Action = m.subject
 
-	err = setMapping(g.ID, g)
+	problems := validate(g)
+	if len(problems) > 0 {
+		invalid(g, problems)
+		return nil, 0
+	}
+
+	// the build mode is kept on every change, as it is stored along with them
+	if m.data["continue_on_error"] == true {
+		for _, c := range g.Changes {
+			gc := c.(*graph.GenericComponent)
+			(*gc)["_continue_on_error"] = true
+		}
+	}
+
+	trace(g)
+
+	revision, err := store.SetMapping(g.ID, g, 0)
 	if err != nil {
-		log.Println("Error: could not store mapping!" + err.Error())
-		return nil
+		messageLog(m).Error("could not store mapping: " + err.Error())
+		return nil, 0
 	}
 
-	return g
+	return g, revision
 }
 
-func (m *Message) getGraphFromComponent() *graph.Graph {
+// getGraphFromStore : will return the latest stored graph
+// of the service the message belongs to
+func (m *Message) getGraphFromStore(store Store) (*graph.Graph, int) {
 	g := graph.New()
 	key := m.getServiceKey()
 
 	id, ok := m.data[key].(string)
 	if ok != true {
-		log.Println("Error: could not get graph from message")
-		return nil
+		messageLog(m).Error("could not get graph from message")
+		return nil, 0
 	}
 
-	mapping, err := getMapping(id)
+	mapping, err := store.GetMapping(id)
 	if err != nil {
-		log.Println("Error: could not get mapping: " + id)
-		log.Println(err.Error())
-		return nil
+		messageLog(m).Error("could not get mapping: " + err.Error())
+		return nil, 0
 	}
 
 	err = g.Load(mapping)
 	if err != nil {
-		log.Println("Error: could not load mapping!" + err.Error())
-		return nil
+		messageLog(m).Error("could not load mapping: " + err.Error())
+		return nil, 0
 	}
 
-	return g
+	return g, getRevision(mapping)
 }
 
 // getServiceKey : get the field key to identify the service
 func (m *Message) getServiceKey() string {
-	if m.getType() == SERVICETYPE {
+	switch m.getType() {
+	case SERVICETYPE, CONTROLTYPE, PLANTYPE, RENDERTYPE:
 		return "id"
 	}
 
 	return "service"
 }
 
+// getServiceID : get the id of the service the message belongs to
+func (m *Message) getServiceID() string {
+	id, _ := m.data[m.getServiceKey()].(string)
+	return id
+}
+
 // getType : a message cab have a type 'service' or 'component'. String
 // 'unsupported' will be returned as default value
 func (m *Message) getType() string {
 	switch m.subject {
 	case "build.create", "build.delete", "build.import", "build.patch", "build.sync":
 		return SERVICETYPE
+	case "build.cancel", "build.pause", "build.resume", "scheduler.release":
+		return CONTROLTYPE
+	case "build.plan":
+		return PLANTYPE
+	case "scheduler.graph.render":
+		return RENDERTYPE
 	}
 
 	if m.data["_component_id"] != nil && m.isCompleted() {
@@ -146,6 +183,20 @@ func (m *Message) getType() string {
 	return "unsupported"
 }
 
+// durable : returns true if the message is delivered again until
+// it is acknowledged as processed
+func (m *Message) durable() bool {
+	return m.ack != nil
+}
+
+// acknowledge : acknowledges a durable message that has been processed,
+// or asks for it to be delivered again if it could not be processed
+func (m *Message) acknowledge(processed bool) {
+	if m.ack != nil {
+		m.ack(processed)
+	}
+}
+
 // isSupported : check to see if the message is supported or not
 func (m *Message) isSupported() bool {
 	if m.getType() == "unsupported" {
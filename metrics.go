@@ -0,0 +1,207 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package main
+
+import (
+	"bufio"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+var (
+	messagesReceived = NewCounter("scheduler_messages_received_total", "Messages received, by type", "type")
+	componentsSent   = NewCounter("scheduler_components_dispatched_total", "Components dispatched, by provider and type", "provider", "type")
+	errorsTotal      = NewCounter("scheduler_errors_total", "Errors found while processing builds")
+	buildsFinished   = NewCounter("scheduler_builds_total", "Builds finished, by result", "result")
+	duplicates       = NewCounter("scheduler_duplicates_discarded_total", "Duplicated component results discarded, by reason", "reason")
+	storeLatency     = NewHistogram("scheduler_store_request_duration_seconds", "Latency of requests to service-store, by subject", []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5}, "subject")
+	componentLatency = NewHistogram("scheduler_component_duration_seconds", "Time components take to reply once dispatched, by provider and type", []float64{1, 5, 15, 30, 60, 300, 600, 1800, 3600}, "provider", "type")
+
+	metrics = NewMetrics(messagesReceived, componentsSent, errorsTotal, buildsFinished, duplicates, storeLatency, componentLatency)
+)
+
+// collector : a metric that can be exposed
+type collector interface {
+	write(w *bufio.Writer)
+}
+
+// series : values of a metric for a set of labels
+type series struct {
+	labels  []string
+	value   float64
+	counts  []uint64
+	sum     float64
+	samples uint64
+}
+
+// metric : a named metric with a value for every set of labels
+type metric struct {
+	mu     sync.Mutex
+	name   string
+	help   string
+	labels []string
+	series map[string]*series
+}
+
+// get : the series of a set of labels, created if it does not exist
+func (m *metric) get(values []string) *series {
+	key := strings.Join(values, "\xff")
+
+	s, ok := m.series[key]
+	if !ok {
+		s = &series{labels: values}
+		m.series[key] = s
+	}
+
+	return s
+}
+
+// sorted : all series of the metric, ordered by their labels
+func (m *metric) sorted() []*series {
+	keys := make([]string, 0, len(m.series))
+	for k := range m.series {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	ss := make([]*series, len(keys))
+	for i, k := range keys {
+		ss[i] = m.series[k]
+	}
+
+	return ss
+}
+
+// header : writes the help and type of the metric
+func (m *metric) header(w *bufio.Writer, kind string) {
+	w.WriteString("# HELP " + m.name + " " + m.help + "\n")
+	w.WriteString("# TYPE " + m.name + " " + kind + "\n")
+}
+
+// labelPairs : formats the labels of a series, along with any extra pairs
+func (m *metric) labelPairs(values []string, extra ...string) string {
+	var pairs []string
+
+	for i, l := range m.labels {
+		pairs = append(pairs, l+"="+strconv.Quote(values[i]))
+	}
+
+	for i := 0; i+1 < len(extra); i += 2 {
+		pairs = append(pairs, extra[i]+"="+strconv.Quote(extra[i+1]))
+	}
+
+	if len(pairs) < 1 {
+		return ""
+	}
+
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+// Counter : a metric that can only increase
+type Counter struct {
+	metric
+}
+
+// NewCounter : Counter constructor
+func NewCounter(name, help string, labels ...string) *Counter {
+	return &Counter{metric{name: name, help: help, labels: labels, series: make(map[string]*series)}}
+}
+
+// Inc : increments the counter for a set of label values
+func (c *Counter) Inc(values ...string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.get(values).value++
+}
+
+func (c *Counter) write(w *bufio.Writer) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.header(w, "counter")
+
+	for _, s := range c.sorted() {
+		w.WriteString(c.name + c.labelPairs(s.labels) + " " + formatFloat(s.value) + "\n")
+	}
+}
+
+// Histogram : a metric that samples observations on buckets
+type Histogram struct {
+	metric
+	buckets []float64
+}
+
+// NewHistogram : Histogram constructor
+func NewHistogram(name, help string, buckets []float64, labels ...string) *Histogram {
+	return &Histogram{
+		metric:  metric{name: name, help: help, labels: labels, series: make(map[string]*series)},
+		buckets: buckets,
+	}
+}
+
+// Observe : adds an observation for a set of label values
+func (h *Histogram) Observe(v float64, values ...string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	s := h.get(values)
+	if s.counts == nil {
+		s.counts = make([]uint64, len(h.buckets))
+	}
+
+	for i, b := range h.buckets {
+		if v <= b {
+			s.counts[i]++
+		}
+	}
+
+	s.sum += v
+	s.samples++
+}
+
+func (h *Histogram) write(w *bufio.Writer) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.header(w, "histogram")
+
+	for _, s := range h.sorted() {
+		for i, b := range h.buckets {
+			w.WriteString(h.name + "_bucket" + h.labelPairs(s.labels, "le", formatFloat(b)) + " " + strconv.FormatUint(s.counts[i], 10) + "\n")
+		}
+		w.WriteString(h.name + "_bucket" + h.labelPairs(s.labels, "le", "+Inf") + " " + strconv.FormatUint(s.samples, 10) + "\n")
+		w.WriteString(h.name + "_sum" + h.labelPairs(s.labels) + " " + formatFloat(s.sum) + "\n")
+		w.WriteString(h.name + "_count" + h.labelPairs(s.labels) + " " + strconv.FormatUint(s.samples, 10) + "\n")
+	}
+}
+
+// Metrics : exposes a collection of metrics on the prometheus text format
+type Metrics struct {
+	collectors []collector
+}
+
+// NewMetrics : Metrics constructor
+func NewMetrics(collectors ...collector) *Metrics {
+	return &Metrics{collectors: collectors}
+}
+
+// ServeHTTP : writes all metrics
+func (m *Metrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+
+	bw := bufio.NewWriter(w)
+	for _, c := range m.collectors {
+		c.write(bw)
+	}
+	bw.Flush()
+}
+
+func formatFloat(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
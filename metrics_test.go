@@ -0,0 +1,47 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package main
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestMetrics(t *testing.T) {
+	Convey("Given a collection of metrics", t, func() {
+		counter := NewCounter("test_received_total", "Received messages", "type")
+		histogram := NewHistogram("test_duration_seconds", "Durations", []float64{1, 5}, "provider")
+		m := NewMetrics(counter, histogram)
+
+		counter.Inc("service")
+		counter.Inc("service")
+		counter.Inc("component")
+		histogram.Observe(0.5, "aws")
+		histogram.Observe(3, "aws")
+
+		Convey("When they are scraped", func() {
+			w := httptest.NewRecorder()
+			m.ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+			body := w.Body.String()
+
+			Convey("It should expose the counters by label", func() {
+				So(body, ShouldContainSubstring, "# TYPE test_received_total counter\n")
+				So(body, ShouldContainSubstring, "test_received_total{type=\"component\"} 1\n")
+				So(body, ShouldContainSubstring, "test_received_total{type=\"service\"} 2\n")
+			})
+
+			Convey("It should expose the histograms with cumulative buckets", func() {
+				So(body, ShouldContainSubstring, "# TYPE test_duration_seconds histogram\n")
+				So(body, ShouldContainSubstring, "test_duration_seconds_bucket{provider=\"aws\",le=\"1\"} 1\n")
+				So(body, ShouldContainSubstring, "test_duration_seconds_bucket{provider=\"aws\",le=\"5\"} 2\n")
+				So(body, ShouldContainSubstring, "test_duration_seconds_bucket{provider=\"aws\",le=\"+Inf\"} 2\n")
+				So(body, ShouldContainSubstring, "test_duration_seconds_sum{provider=\"aws\"} 3.5\n")
+				So(body, ShouldContainSubstring, "test_duration_seconds_count{provider=\"aws\"} 2\n")
+			})
+		})
+	})
+}
@@ -0,0 +1,143 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package main
+
+import (
+	"errors"
+	"hash/fnv"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/nats-io/go-nats"
+)
+
+// PARTITIONPREFIX : prefix of the subjects messages are forwarded
+// on to the replica that owns their build
+const PARTITIONPREFIX = "scheduler.partition."
+
+// ErrUnpartitionedGroup : returned when replicas share a queue group without
+// partitioning the builds, so the messages of a build would be spread across them
+var ErrUnpartitionedGroup = errors.New("a queue group requires SCHEDULER_PARTITIONS to be greater than one")
+
+// ErrUngroupedPartitions : returned when builds are partitioned without a queue
+// group, so every replica would receive and forward all messages
+var ErrUngroupedPartitions = errors.New("several partitions require SCHEDULER_QUEUE_GROUP to be set")
+
+// Partitioning : distributes the builds across replicas of the scheduler.
+// Replicas on the same queue group share the messages received, and
+// every build is owned by one of its partitions, so all of its messages
+// are processed in order by the replica running that partition
+type Partitioning struct {
+	Group string
+	Count int
+	Index int
+}
+
+// partitioning : gets the queue group and partition of the scheduler
+// from the environment. By default there is a single partition and no
+// queue group, so every replica receives all messages
+func partitioning() Partitioning {
+	p := Partitioning{
+		Group: os.Getenv("SCHEDULER_QUEUE_GROUP"),
+		Count: 1,
+	}
+
+	if v := os.Getenv("SCHEDULER_PARTITIONS"); v != "" {
+		count, err := strconv.Atoi(v)
+		if err != nil || count < 1 {
+			logger.Error("invalid number of partitions: " + v)
+			return p
+		}
+		p.Count = count
+	}
+
+	if v := os.Getenv("SCHEDULER_PARTITION"); v != "" {
+		index, err := strconv.Atoi(v)
+		if err != nil || index < 0 || index >= p.Count {
+			logger.Error("invalid partition: " + v)
+			p.Count = 1
+			return p
+		}
+		p.Index = index
+	}
+
+	return p
+}
+
+// validate : checks that the messages of every build will be
+// processed in order by the replica that owns it
+func (p Partitioning) validate() error {
+	if p.Group != "" && p.Count < 2 {
+		return ErrUnpartitionedGroup
+	}
+
+	if p.Group == "" && p.Count > 1 {
+		return ErrUngroupedPartitions
+	}
+
+	return nil
+}
+
+// owner : partition that owns a build
+func (p Partitioning) owner(id string) int {
+	if p.Count < 2 {
+		return 0
+	}
+
+	h := fnv.New32a()
+	h.Write([]byte(id))
+
+	return int(h.Sum32() % uint32(p.Count))
+}
+
+// subscribe : subscribes to a subject, on the queue group if there is one
+func (p Partitioning) subscribe(conn *nats.Conn, subject string, handler nats.MsgHandler) (*nats.Subscription, error) {
+	if p.Group == "" {
+		return conn.Subscribe(subject, handler)
+	}
+
+	return conn.QueueSubscribe(subject, p.Group, handler)
+}
+
+// partitionSubject : subject a message is forwarded on to a partition
+func partitionSubject(index int, subject string) string {
+	return PARTITIONPREFIX + strconv.Itoa(index) + "." + subject
+}
+
+// forward : sends a message to the partition that owns its build.
+// Returns false if the message is owned by this partition
+func (s *Subscriber) forward(msg *nats.Msg, id string) bool {
+	owner := s.partitions.owner(id)
+	if id == "" || owner == s.partitions.Index {
+		return false
+	}
+
+	s.mu.Lock()
+	conn := s.conn
+	s.mu.Unlock()
+
+	l := serviceLog(id).With(Fields{"subject": msg.Subject})
+	l.Debug("forwarding message to partition " + strconv.Itoa(owner))
+
+	err := conn.PublishRequest(partitionSubject(owner, msg.Subject), msg.Reply, msg.Data)
+	if err != nil {
+		l.Error("could not forward message: " + err.Error())
+	}
+
+	return true
+}
+
+// handlePartition : handles a message forwarded to this partition
+func (s *Subscriber) handlePartition(msg *nats.Msg) {
+	prefix := partitionSubject(s.partitions.Index, "")
+
+	s.Handle(&nats.Msg{
+		Subject: strings.TrimPrefix(msg.Subject, prefix),
+		Reply:   msg.Reply,
+		Data:    msg.Data,
+		Sub:     msg.Sub,
+	})
+}
@@ -0,0 +1,88 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package main
+
+import (
+	"strconv"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestPartitioning(t *testing.T) {
+	Convey("Given a scheduler with several partitions", t, func() {
+		p := Partitioning{Group: "scheduler", Count: 3, Index: 1}
+
+		Convey("When getting the owner of a build", func() {
+			owners := make(map[int]bool)
+			for i := 0; i < 100; i++ {
+				owner := p.owner("service-" + strconv.Itoa(i))
+				So(owner, ShouldBeBetweenOrEqual, 0, 2)
+				owners[owner] = true
+			}
+
+			Convey("It should always be the same partition", func() {
+				So(p.owner("service-1"), ShouldEqual, p.owner("service-1"))
+			})
+
+			Convey("It should distribute the builds across all partitions", func() {
+				So(owners, ShouldHaveLength, 3)
+			})
+		})
+
+		Convey("When forwarding a message to a partition", func() {
+			subject := partitionSubject(2, "instance.create.aws.done")
+
+			Convey("It should prefix its subject with the partition", func() {
+				So(subject, ShouldEqual, "scheduler.partition.2.instance.create.aws.done")
+			})
+		})
+	})
+
+	Convey("Given the partitioning of the scheduler", t, func() {
+		Convey("When replicas share a queue group without partitions", func() {
+			p := Partitioning{Group: "scheduler", Count: 1}
+
+			Convey("It should not be valid", func() {
+				So(p.validate(), ShouldEqual, ErrUnpartitionedGroup)
+			})
+		})
+
+		Convey("When builds are partitioned without a queue group", func() {
+			p := Partitioning{Count: 3}
+
+			Convey("It should not be valid", func() {
+				So(p.validate(), ShouldEqual, ErrUngroupedPartitions)
+			})
+		})
+
+		Convey("When partitions share a queue group", func() {
+			p := Partitioning{Group: "scheduler", Count: 3, Index: 1}
+
+			Convey("It should be valid", func() {
+				So(p.validate(), ShouldBeNil)
+			})
+		})
+
+		Convey("When there is a single scheduler", func() {
+			p := Partitioning{Count: 1}
+
+			Convey("It should be valid", func() {
+				So(p.validate(), ShouldBeNil)
+			})
+		})
+	})
+
+	Convey("Given a scheduler with a single partition", t, func() {
+		p := Partitioning{Count: 1}
+
+		Convey("When getting the owner of a build", func() {
+			Convey("It should always be owned by the scheduler", func() {
+				So(p.owner("service-1"), ShouldEqual, 0)
+				So(p.owner("service-2"), ShouldEqual, 0)
+			})
+		})
+	})
+}
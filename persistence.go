@@ -5,21 +5,46 @@
 package main
 
 import (
+	"bytes"
 	"encoding/json"
+	"errors"
 	"time"
 
+	"github.com/nats-io/go-nats"
 	graph "gopkg.in/r3labs/graph.v2"
 )
 
 type service struct {
-	ID      string       `json:"id"`
-	Mapping *graph.Graph `json:"mapping"`
+	ID       string       `json:"id"`
+	Revision int          `json:"revision"`
+	Mapping  *graph.Graph `json:"mapping"`
 }
 
-func getMapping(id string) (map[string]interface{}, error) {
+// ErrInvalidReply : returned when service-store replies to an update
+// with a message that can not be understood
+var ErrInvalidReply = errors.New("invalid reply from service-store")
+
+// reply : response of service-store to a mapping update
+type reply struct {
+	Revision int    `json:"revision"`
+	Error    string `json:"error"`
+}
+
+// NatsStore : stores mappings on service-store through nats
+type NatsStore struct {
+	conn *nats.Conn
+}
+
+// NewNatsStore : NatsStore constructor
+func NewNatsStore(conn *nats.Conn) *NatsStore {
+	return &NatsStore{conn: conn}
+}
+
+// GetMapping : gets the latest mapping of a service
+func (s *NatsStore) GetMapping(id string) (map[string]interface{}, error) {
 	var mapping map[string]interface{}
 
-	msg, err := nc.Request("build.get.mapping", []byte(`{"id":"`+id+`"}`), time.Second*5)
+	msg, err := s.roundTrip("build.get.mapping", []byte(`{"id":"`+id+`"}`))
 	if err != nil {
 		return mapping, err
 	}
@@ -29,65 +54,126 @@ func getMapping(id string) (map[string]interface{}, error) {
 	return mapping, err
 }
 
-func setMapping(id string, mapping *graph.Graph) error {
-	s := service{
-		ID:      id,
-		Mapping: mapping,
+// SetMapping : stores the mapping of a service
+func (s *NatsStore) SetMapping(id string, mapping *graph.Graph, revision int) (int, error) {
+	sv := service{
+		ID:       id,
+		Revision: revision,
+		Mapping:  mapping,
 	}
 
-	data, err := json.Marshal(s)
+	data, err := json.Marshal(sv)
 	if err != nil {
-		return err
+		return revision, err
 	}
 
-	_, err = nc.Request("build.set.mapping", data, time.Second*5)
+	return s.request("build.set.mapping", data, revision)
+}
+
+// SetComponent : stores a component on the mapping's components
+func (s *NatsStore) SetComponent(c graph.Component, revision int) (int, error) {
+	data, err := withRevision(c, revision)
 	if err != nil {
-		return err
+		return revision, err
 	}
 
-	return err
+	return s.request("build.set.mapping.component", data, revision)
 }
 
-func setComponent(c graph.Component) error {
-	data, err := json.Marshal(c)
+// DeleteComponent : removes a component from the mapping's components
+func (s *NatsStore) DeleteComponent(c graph.Component, revision int) (int, error) {
+	data, err := withRevision(c, revision)
 	if err != nil {
-		return err
+		return revision, err
 	}
 
-	_, err = nc.Request("build.set.mapping.component", data, time.Second*5)
-
-	return err
+	return s.request("build.del.mapping.component", data, revision)
 }
 
-func deleteComponent(c graph.Component) error {
-	data, err := json.Marshal(c)
+// SetChange : stores a component on the mapping's changes
+func (s *NatsStore) SetChange(c graph.Component, revision int) (int, error) {
+	data, err := withRevision(c, revision)
 	if err != nil {
-		return err
+		return revision, err
 	}
 
-	_, err = nc.Request("build.del.mapping.component", data, time.Second*5)
+	return s.request("build.set.mapping.change", data, revision)
+}
+
+// DeleteChange : removes a component from the mapping's changes
+func (s *NatsStore) DeleteChange(c graph.Component, revision int) (int, error) {
+	data, err := withRevision(c, revision)
+	if err != nil {
+		return revision, err
+	}
 
-	return err
+	return s.request("build.del.mapping.change", data, revision)
 }
 
-func setChange(c graph.Component) error {
-	data, err := json.Marshal(c)
+// request : sends an update to service-store and returns the
+// revision of the mapping after the update has been applied
+func (s *NatsStore) request(subject string, data []byte, revision int) (int, error) {
+	msg, err := s.roundTrip(subject, data)
 	if err != nil {
-		return err
+		return revision, err
 	}
 
-	_, err = nc.Request("build.set.mapping.change", data, time.Second*5)
+	return parseReply(msg.Data, revision)
+}
+
+// parseReply : gets the revision of the mapping from a reply of service-store,
+// or the error it has replied with. Empty replies are treated as unversioned
+func parseReply(data []byte, revision int) (int, error) {
+	var r reply
 
-	return err
+	if len(bytes.TrimSpace(data)) == 0 {
+		return revision, nil
+	}
+
+	if err := json.Unmarshal(data, &r); err != nil {
+		return revision, ErrInvalidReply
+	}
+
+	switch r.Error {
+	case "":
+	case "conflict":
+		return revision, ErrConflict
+	default:
+		return revision, errors.New(r.Error)
+	}
+
+	if r.Revision > 0 {
+		return r.Revision, nil
+	}
+
+	return revision, nil
 }
 
-func deleteChange(c graph.Component) error {
-	data, err := json.Marshal(c)
-	if err != nil {
-		return err
+// roundTrip : sends a request to service-store, recording its latency
+// and the time of the last request that succeeded
+func (s *NatsStore) roundTrip(subject string, data []byte) (*nats.Msg, error) {
+	start := time.Now()
+
+	msg, err := s.conn.Request(subject, data, time.Second*5)
+	storeLatency.Observe(time.Since(start).Seconds(), subject)
+
+	if err == nil {
+		storeRoundTrip.Store(time.Now().UTC())
 	}
 
-	_, err = nc.Request("build.del.mapping.change", data, time.Second*5)
+	return msg, err
+}
+
+// withRevision : marshals a component along with the
+// revision of the mapping it was based on
+func withRevision(c graph.Component, revision int) ([]byte, error) {
+	gc := c.(*graph.GenericComponent)
+
+	data := make(map[string]interface{}, len(*gc)+1)
+	for k, v := range *gc {
+		data[k] = v
+	}
+	data["_revision"] = revision
 
-	return err
+	return json.Marshal(data)
 }
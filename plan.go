@@ -0,0 +1,116 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package main
+
+import (
+	graph "gopkg.in/r3labs/graph.v2"
+)
+
+// PlannedComponent : a component that would be dispatched by a build
+type PlannedComponent struct {
+	ID       string `json:"_component_id"`
+	Type     string `json:"_component"`
+	Action   string `json:"_action"`
+	Provider string `json:"_provider"`
+}
+
+// Plan : simulates all components completing successfully, and returns the
+// waves of components that would be dispatched. All components on a wave run
+// in parallel, and are dispatched once the previous wave has completed
+func (s Scheduler) Plan() ([][]graph.Component, error) {
+	var waves [][]graph.Component
+
+	wave := running(s.Unblocked())
+
+	for len(wave) > 0 {
+		var next []graph.Component
+
+		waves = append(waves, wave)
+
+		for _, c := range wave {
+			s.slots.Release(s.graph.ID, c)
+			c.SetState(STATUSCOMPLETED)
+
+			cs, err := s.Receive(c)
+			if err != nil {
+				return waves, err
+			}
+
+			next = append(next, running(cs)...)
+		}
+
+		wave = next
+	}
+
+	return waves, nil
+}
+
+// running : returns the components that have been given a slot to run
+func running(cs []graph.Component) []graph.Component {
+	var rcs []graph.Component
+
+	for _, c := range cs {
+		if c.GetState() == STATUSRUNNING {
+			rcs = append(rcs, c)
+		}
+	}
+
+	return rcs
+}
+
+// plan : replies with the execution plan of the build attached to
+// the message. Nothing is sent nor stored while planning
+func (s *Subscriber) plan(m *Message) {
+	g := graph.New()
+
+	err := g.Load(m.data)
+	if err != nil {
+		messageLog(m).Error("could not load mapping: " + err.Error())
+		respond(m, "error", map[string]interface{}{"error": err.Error()})
+		return
+	}
+
+	problems := validate(g)
+	if len(problems) > 0 {
+		respond(m, "error", map[string]interface{}{
+			"id":       g.ID,
+			"error":    "invalid mapping",
+			"problems": problems,
+		})
+		return
+	}
+
+	// the plan does not take slots from the builds in progress
+	var slots *Concurrency
+	if s.slots != nil {
+		slots = NewConcurrency(s.slots.limits)
+	}
+
+	scheduler := Scheduler{graph: g, slots: slots}
+
+	waves, err := scheduler.Plan()
+	if err != nil {
+		respond(m, "error", map[string]interface{}{"id": g.ID, "error": err.Error()})
+		return
+	}
+
+	planned := make([][]PlannedComponent, len(waves))
+	for i, wave := range waves {
+		planned[i] = make([]PlannedComponent, len(wave))
+		for j, c := range wave {
+			planned[i][j] = PlannedComponent{
+				ID:       c.GetID(),
+				Type:     c.GetType(),
+				Action:   c.GetAction(),
+				Provider: c.GetProvider(),
+			}
+		}
+	}
+
+	respond(m, "done", map[string]interface{}{
+		"id":    g.ID,
+		"waves": planned,
+	})
+}
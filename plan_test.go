@@ -0,0 +1,62 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package main
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+	graph "gopkg.in/r3labs/graph.v2"
+)
+
+func waveIDs(wave []graph.Component) []string {
+	var ids []string
+
+	for _, c := range wave {
+		ids = append(ids, c.GetID())
+	}
+
+	return ids
+}
+
+func TestPlan(t *testing.T) {
+	Convey("Given a scheduler", t, func() {
+		s := Scheduler{graph: loadTestMapping("test")}
+
+		Convey("When planning a build", func() {
+			waves, err := s.Plan()
+
+			Convey("It should return the components in the order they would be dispatched", func() {
+				So(err, ShouldBeNil)
+				So(waves, ShouldHaveLength, 2)
+				So(waveIDs(waves[0]), ShouldHaveLength, 5)
+				So(waveIDs(waves[0]), ShouldContain, "instance::db-1")
+				So(waveIDs(waves[0]), ShouldContain, "network::web-new")
+				So(waveIDs(waves[0]), ShouldContain, "instance::web-1")
+				So(waveIDs(waves[1]), ShouldHaveLength, 5)
+				So(waveIDs(waves[1]), ShouldContain, "instance::db-2")
+				So(waveIDs(waves[1]), ShouldContain, "instance::web-new-1")
+				So(waveIDs(waves[1]), ShouldContain, "network::web")
+			})
+		})
+
+		Convey("When planning a build with limited concurrency", func() {
+			s.slots = NewConcurrency(Limits{Service: 3})
+			waves, err := s.Plan()
+
+			Convey("It should not run more components at once than allowed", func() {
+				So(err, ShouldBeNil)
+				So(len(waves), ShouldBeGreaterThan, 2)
+
+				total := 0
+				for _, wave := range waves {
+					So(len(wave), ShouldBeLessThanOrEqualTo, 3)
+					total = total + len(wave)
+				}
+				So(total, ShouldEqual, 10)
+			})
+		})
+	})
+}
@@ -0,0 +1,76 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package main
+
+import (
+	"sort"
+
+	graph "gopkg.in/r3labs/graph.v2"
+)
+
+// prioritize : sorts components so the ones with the highest '_priority' are
+// scheduled first, followed by the ones on the longest remaining path
+func (s Scheduler) prioritize(cs []graph.Component) []graph.Component {
+	lengths := make(map[string]float64)
+
+	for _, c := range cs {
+		lengths[c.GetID()] = s.pathLength(c.GetID(), lengths, make(map[string]bool))
+	}
+
+	sort.SliceStable(cs, func(i, j int) bool {
+		pi, pj := getPriority(cs[i]), getPriority(cs[j])
+		if pi != pj {
+			return pi > pj
+		}
+
+		return lengths[cs[i].GetID()] > lengths[cs[j].GetID()]
+	})
+
+	return cs
+}
+
+// pathLength : length of the longest path from a component
+// to the end of the graph, as defined by its edges
+func (s Scheduler) pathLength(id string, lengths map[string]float64, visiting map[string]bool) float64 {
+	var longest float64
+
+	if l, ok := lengths[id]; ok {
+		return l
+	}
+
+	// cycles are not followed
+	if visiting[id] {
+		return 0
+	}
+	visiting[id] = true
+
+	for _, edge := range s.graph.Edges {
+		if edge.Source != id {
+			continue
+		}
+
+		l := float64(edge.Length) + s.pathLength(edge.Destination, lengths, visiting)
+		if l > longest {
+			longest = l
+		}
+	}
+
+	delete(visiting, id)
+	lengths[id] = longest
+
+	return longest
+}
+
+// getPriority : priority of a component, defined by its '_priority' field
+func getPriority(c graph.Component) float64 {
+	gc, ok := c.(*graph.GenericComponent)
+	if !ok {
+		return 0
+	}
+
+	priority, _ := (*gc)["_priority"].(float64)
+
+	return priority
+}
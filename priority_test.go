@@ -0,0 +1,54 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package main
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+	graph "gopkg.in/r3labs/graph.v2"
+)
+
+func TestPriority(t *testing.T) {
+	Convey("Given a scheduler", t, func() {
+		bms, err := loadjsongraph("./fixtures/test-graph.json")
+		So(err, ShouldBeNil)
+
+		s := Scheduler{graph: graph.New()}
+		So(s.graph.Load(bms), ShouldBeNil)
+
+		Convey("When calculating the remaining path of a component", func() {
+			lengths := make(map[string]float64)
+			Convey("It should return the length of its longest path to the end", func() {
+				So(s.pathLength("start", lengths, make(map[string]bool)), ShouldEqual, 3)
+				So(s.pathLength("instance::db-1", lengths, make(map[string]bool)), ShouldEqual, 2)
+				So(s.pathLength("instance::web-new-1", lengths, make(map[string]bool)), ShouldEqual, 1)
+				So(s.pathLength("end", lengths, make(map[string]bool)), ShouldEqual, 0)
+			})
+		})
+
+		Convey("When prioritizing components", func() {
+			cs := []graph.Component{
+				s.graph.ComponentAll("instance::web-new-1"),
+				s.graph.ComponentAll("instance::web-new-2"),
+				s.graph.ComponentAll("instance::db-1"),
+			}
+
+			Convey("It should schedule the ones on the longest path first", func() {
+				cs = s.prioritize(cs)
+				So(cs[0].GetID(), ShouldEqual, "instance::db-1")
+				So(cs[1].GetID(), ShouldEqual, "instance::web-new-1")
+				So(cs[2].GetID(), ShouldEqual, "instance::web-new-2")
+			})
+
+			Convey("It should schedule the ones with the highest priority first", func() {
+				(*cs[1].(*graph.GenericComponent))["_priority"] = float64(10)
+				cs = s.prioritize(cs)
+				So(cs[0].GetID(), ShouldEqual, "instance::web-new-2")
+				So(cs[1].GetID(), ShouldEqual, "instance::db-1")
+			})
+		})
+	})
+}
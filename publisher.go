@@ -6,45 +6,218 @@ package main
 
 import (
 	"encoding/json"
-	"log"
+	"time"
 
 	graph "gopkg.in/r3labs/graph.v2"
 )
 
+// publish : publishes a message on the nats connection
+var publish = func(subject string, data []byte) error {
+	return nc.Publish(subject, data)
+}
+
 func send(c graph.Component) error {
 	data, err := json.Marshal(c)
 	if err != nil {
 		return err
 	}
 
-	subject := c.GetType() + "." + c.GetAction() + "." + c.GetProvider()
-	log.Printf("sending: %s", subject)
+	subject := componentSubject(c)
+	componentLog(c).With(Fields{"subject": subject}).Info("sending component")
 
-	return nc.Publish(subject, data)
+	return publish(subject, data)
+}
+
+// componentSubject : the subject a component is sent to
+func componentSubject(c graph.Component) string {
+	return c.GetType() + "." + c.GetAction() + "." + c.GetProvider()
+}
+
+// timedOut : publishes an error on behalf of a component that has not
+// replied in time, to be processed as any other errored component
+func timedOut(c graph.Component, timeout time.Duration) {
+	failed(c, "component timed out after "+timeout.String())
+}
+
+// notRetried : publishes an error on behalf of a component that has not
+// been retried, as its build was halted while waiting to retry it
+func notRetried(c graph.Component) {
+	failed(c, "component was not retried as its build has been halted")
+}
+
+// failed : publishes an error on behalf of a component, to
+// be processed as if the component had replied with it
+func failed(c graph.Component, reason string) {
+	c.SetState(STATUSERRORED)
+
+	gc := c.(*graph.GenericComponent)
+	(*gc)["error"] = reason
+
+	subject := componentSubject(c) + ".error"
+	l := componentLog(c).With(Fields{"subject": subject})
+
+	data, err := json.Marshal(c)
+	if err != nil {
+		l.Error(err.Error())
+		return
+	}
+
+	l.Warn(reason)
+
+	err = publish(subject, data)
+	if err != nil {
+		l.Error(err.Error())
+	}
 }
 
 func errored(g *graph.Graph, err error) {
-	log.Println("Error: " + err.Error())
+	l := logger
+	if g != nil {
+		l = serviceLog(g.ID).With(Fields{"subject": g.Action + ".error"})
+	}
+	l.Error(err.Error())
+
+	if err == ErrProvisioningFailed {
+		buildsFinished.Inc("failed")
+	} else {
+		errorsTotal.Inc()
+	}
 
 	if g != nil {
-		data, _ := g.ToJSON()
-		err := nc.Publish(g.Action+".error", data)
+		data, _ := report(g)
+		err := publish(g.Action+".error", data)
 		if err != nil {
-			log.Println(err.Error())
+			l.Error(err.Error())
 		}
 	}
 }
 
+// invalid : notifies a build has been rejected, along with
+// the problems found when validating it
+func invalid(g *graph.Graph, problems []Problem) {
+	l := serviceLog(g.ID).With(Fields{"subject": g.Action + ".error"})
+	l.With(Fields{"problems": problems}).Warn("invalid mapping")
+
+	data, err := json.Marshal(map[string]interface{}{
+		"id":       g.ID,
+		"error":    "invalid mapping",
+		"problems": problems,
+	})
+	if err != nil {
+		l.Error(err.Error())
+		return
+	}
+
+	err = publish(g.Action+".error", data)
+	if err != nil {
+		l.Error(err.Error())
+	}
+}
+
+// report : the mapping of a build, along with the ids of the components
+// that have failed and that have been skipped, and a summary of its execution
+func report(g *graph.Graph) ([]byte, error) {
+	var r map[string]interface{}
+
+	data, err := g.ToJSON()
+	if err != nil {
+		return data, err
+	}
+
+	err = json.Unmarshal(data, &r)
+	if err != nil {
+		return data, err
+	}
+
+	scheduler := Scheduler{graph: g}
+	r["failed"], r["skipped"] = scheduler.Failures()
+	r["summary"] = scheduler.Summary()
+
+	return json.Marshal(r)
+}
+
 func completed(g *graph.Graph) {
-	log.Println("Completed: " + g.ID)
+	l := serviceLog(g.ID).With(Fields{"subject": g.Action + ".done"})
+	l.Info("build completed")
+	buildsFinished.Inc("completed")
+
+	data, err := report(g)
+	if err != nil {
+		l.Error(err.Error())
+	}
+
+	err = publish(g.Action+".done", data)
+	if err != nil {
+		l.Error(err.Error())
+	}
+}
+
+func cancelled(g *graph.Graph) {
+	l := serviceLog(g.ID).With(Fields{"subject": "build.cancel.done"})
+	l.Info("build cancelled")
+	buildsFinished.Inc("cancelled")
 
 	data, err := g.ToJSON()
 	if err != nil {
-		log.Println(err.Error())
+		l.Error(err.Error())
+	}
+
+	err = publish("build.cancel.done", data)
+	if err != nil {
+		l.Error(err.Error())
+	}
+}
+
+// acknowledged : notifies a control message has been applied to a build
+func acknowledged(subject string, g *graph.Graph) {
+	l := serviceLog(g.ID).With(Fields{"subject": subject + ".done"})
+	l.Info("control message applied")
+
+	data, err := g.ToJSON()
+	if err != nil {
+		l.Error(err.Error())
+	}
+
+	err = publish(subject+".done", data)
+	if err != nil {
+		l.Error(err.Error())
+	}
+}
+
+// rejected : notifies a control message could not be applied to a build
+func rejected(subject string, g *graph.Graph, err error) {
+	l := serviceLog(g.ID).With(Fields{"subject": subject + ".error"})
+	l.Warn("control message rejected: " + err.Error())
+
+	data, _ := json.Marshal(map[string]string{
+		"id":    g.ID,
+		"error": err.Error(),
+	})
+
+	err = publish(subject+".error", data)
+	if err != nil {
+		l.Error(err.Error())
+	}
+}
+
+// respond : replies to a request with its result, or publishes it
+// on the status subject of the request if no reply was expected
+func respond(m *Message, status string, result map[string]interface{}) {
+	subject := m.reply
+	if subject == "" {
+		subject = m.subject + "." + status
+	}
+
+	l := messageLog(m).With(Fields{"subject": subject})
+
+	data, err := json.Marshal(result)
+	if err != nil {
+		l.Error(err.Error())
+		return
 	}
 
-	err = nc.Publish(g.Action+".done", data)
+	err = publish(subject, data)
 	if err != nil {
-		log.Println(err.Error())
+		l.Error(err.Error())
 	}
 }
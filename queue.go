@@ -0,0 +1,98 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// ServiceQueue : serializes the processing of messages that belong to the
+// same service, while messages of different services are processed in parallel.
+type ServiceQueue struct {
+	mu      sync.Mutex
+	handler func(*Message)
+	pending map[string][]*Message
+	count   int
+	wg      sync.WaitGroup
+}
+
+// NewServiceQueue : ServiceQueue constructor
+func NewServiceQueue(handler func(*Message)) *ServiceQueue {
+	return &ServiceQueue{
+		handler: handler,
+		pending: make(map[string][]*Message),
+	}
+}
+
+// Push : queues a message to be handled after any other
+// message already queued for the same service
+func (q *ServiceQueue) Push(id string, m *Message) {
+	q.wg.Add(1)
+
+	q.mu.Lock()
+	messages, active := q.pending[id]
+	q.pending[id] = append(messages, m)
+	q.count++
+	q.mu.Unlock()
+
+	if !active {
+		go q.work(id)
+	}
+}
+
+// work : handles all queued messages for a service in order, and exits
+// once there are no more messages left for it
+func (q *ServiceQueue) work(id string) {
+	for {
+		q.mu.Lock()
+		messages := q.pending[id]
+		if len(messages) < 1 {
+			delete(q.pending, id)
+			q.mu.Unlock()
+			return
+		}
+		q.pending[id] = messages[1:]
+		q.mu.Unlock()
+
+		q.handler(messages[0])
+
+		q.mu.Lock()
+		q.count--
+		q.mu.Unlock()
+		q.wg.Done()
+	}
+}
+
+// Len : returns the number of messages queued that have not been handled yet
+func (q *ServiceQueue) Len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	return q.count
+}
+
+// Wait : waits until all queued messages have been handled, and returns
+// true, or returns false if they have not been handled before the timeout
+func (q *ServiceQueue) Wait(timeout time.Duration) bool {
+	return wait(&q.wg, timeout)
+}
+
+// wait : waits for a wait group to be done, up to a timeout
+func wait(wg *sync.WaitGroup, timeout time.Duration) bool {
+	done := make(chan struct{})
+
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
+}
@@ -0,0 +1,120 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package main
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestServiceQueue(t *testing.T) {
+	Convey("Given a service queue", t, func() {
+		var mu sync.Mutex
+		var wg sync.WaitGroup
+
+		handled := make(map[string][]string)
+		active := make(map[string]int)
+		overlapped := false
+
+		q := NewServiceQueue(func(m *Message) {
+			id := m.getServiceID()
+
+			mu.Lock()
+			active[id]++
+			if active[id] > 1 {
+				overlapped = true
+			}
+			mu.Unlock()
+
+			time.Sleep(time.Millisecond)
+
+			mu.Lock()
+			active[id]--
+			handled[id] = append(handled[id], m.subject)
+			mu.Unlock()
+
+			wg.Done()
+		})
+
+		Convey("When messages for several services are pushed", func() {
+			subjects := []string{"a.done", "b.done", "c.done", "d.done"}
+
+			for _, id := range []string{"service-1", "service-2"} {
+				for _, subject := range subjects {
+					m, err := NewMessage(subject, []byte(`{"service":"`+id+`"}`))
+					So(err, ShouldBeNil)
+					wg.Add(1)
+					q.Push(id, m)
+				}
+			}
+
+			wg.Wait()
+
+			Convey("It should handle each service's messages in order", func() {
+				So(handled["service-1"], ShouldResemble, subjects)
+				So(handled["service-2"], ShouldResemble, subjects)
+			})
+
+			Convey("It should never handle two messages of a service at once", func() {
+				So(overlapped, ShouldBeFalse)
+			})
+		})
+
+		Convey("When waiting for the messages pushed", func() {
+			for _, subject := range []string{"a.done", "b.done"} {
+				m, err := NewMessage(subject, []byte(`{"service":"service-1"}`))
+				So(err, ShouldBeNil)
+				wg.Add(1)
+				q.Push("service-1", m)
+			}
+
+			Convey("It should return once all of them have been handled", func() {
+				So(q.Wait(time.Second), ShouldBeTrue)
+				So(handled["service-1"], ShouldHaveLength, 2)
+			})
+		})
+	})
+
+	Convey("Given a service queue handling a slow message", t, func() {
+		release := make(chan struct{})
+		q := NewServiceQueue(func(m *Message) {
+			<-release
+		})
+
+		m, err := NewMessage("a.done", []byte(`{"service":"service-1"}`))
+		So(err, ShouldBeNil)
+		q.Push("service-1", m)
+
+		Convey("When more messages are pushed for the same service", func() {
+			for _, subject := range []string{"b.done", "c.done"} {
+				m, err := NewMessage(subject, []byte(`{"service":"service-1"}`))
+				So(err, ShouldBeNil)
+				q.Push("service-1", m)
+			}
+
+			pending := q.Len()
+			close(release)
+
+			Convey("It should count all messages not handled yet", func() {
+				So(pending, ShouldEqual, 3)
+				So(q.Wait(time.Second), ShouldBeTrue)
+				So(q.Len(), ShouldEqual, 0)
+			})
+		})
+
+		Convey("When waiting for it with a timeout", func() {
+			finished := q.Wait(10 * time.Millisecond)
+			close(release)
+
+			Convey("It should give up once the timeout expires", func() {
+				So(finished, ShouldBeFalse)
+				So(q.Wait(time.Second), ShouldBeTrue)
+			})
+		})
+	})
+}
@@ -0,0 +1,254 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package main
+
+import (
+	"bytes"
+	"errors"
+	"html"
+	"strconv"
+	"strings"
+
+	graph "gopkg.in/r3labs/graph.v2"
+)
+
+// ErrUnsupportedFormat : returned when rendering a graph on an unknown format
+var ErrUnsupportedFormat = errors.New("unsupported format")
+
+const (
+	// SVGNODEWIDTH : width of the nodes of a graph rendered as svg
+	SVGNODEWIDTH = 200
+	// SVGNODEHEIGHT : height of the nodes of a graph rendered as svg
+	SVGNODEHEIGHT = 40
+	// SVGGAP : space between the nodes of a graph rendered as svg
+	SVGGAP = 30
+)
+
+// stateColours : colour of the components on each state
+var stateColours = map[string]string{
+	STATUSWAITING:   "#ffffff",
+	STATUSQUEUED:    "#e0e0e0",
+	STATUSRUNNING:   "#90caf9",
+	STATUSCOMPLETED: "#a5d6a7",
+	STATUSERRORED:   "#ef9a9a",
+	STATUSCANCELLED: "#bdbdbd",
+	STATUSPAUSED:    "#fff59d",
+	STATUSSKIPPED:   "#ffcc80",
+}
+
+// stateColour : colour of a component on a state
+func stateColour(state string) string {
+	if colour, ok := stateColours[state]; ok {
+		return colour
+	}
+
+	return stateColours[STATUSWAITING]
+}
+
+// Render : renders the graph on the given format, either 'dot', 'mermaid' or 'svg'
+func (s Scheduler) Render(format string) (string, error) {
+	switch format {
+	case "", "dot":
+		return s.DOT(), nil
+	case "mermaid":
+		return s.Mermaid(), nil
+	case "svg":
+		return s.SVG(), nil
+	}
+
+	return "", ErrUnsupportedFormat
+}
+
+// DOT : renders the graph on the graphviz dot format, with all
+// changes labelled by their action and coloured by their state
+func (s Scheduler) DOT() string {
+	var b bytes.Buffer
+
+	b.WriteString("digraph " + strconv.Quote(s.graph.ID) + " {\n")
+	b.WriteString("  node [shape=box, style=filled];\n")
+	b.WriteString("  \"start\" [shape=circle];\n")
+	b.WriteString("  \"end\" [shape=circle];\n")
+
+	for _, c := range s.graph.Changes {
+		b.WriteString("  " + strconv.Quote(c.GetID()))
+		b.WriteString(" [label=" + strconv.Quote(c.GetID()+"\n"+c.GetAction()))
+		b.WriteString(", fillcolor=" + strconv.Quote(stateColour(c.GetState())) + "];\n")
+	}
+
+	for _, e := range s.renderedEdges() {
+		b.WriteString("  " + strconv.Quote(e.Source) + " -> " + strconv.Quote(e.Destination) + ";\n")
+	}
+
+	b.WriteString("}\n")
+
+	return b.String()
+}
+
+// Mermaid : renders the graph as a mermaid flowchart, with all
+// changes labelled by their action and coloured by their state
+func (s Scheduler) Mermaid() string {
+	var b bytes.Buffer
+
+	// mermaid ids can not contain the characters used on component
+	// ids, and 'end' is a reserved word
+	nodes := map[string]string{"start": "start", "end": "finish"}
+	states := make(map[string][]string)
+
+	b.WriteString("graph TD\n")
+	b.WriteString("  start((start))\n")
+	b.WriteString("  finish((end))\n")
+
+	for i, c := range s.graph.Changes {
+		id := "c" + strconv.Itoa(i)
+		nodes[c.GetID()] = id
+
+		state := c.GetState()
+		if _, ok := stateColours[state]; !ok {
+			state = STATUSWAITING
+		}
+		states[state] = append(states[state], id)
+
+		b.WriteString("  " + id + "[\"" + mermaidEscape(c.GetID()) + "<br/>" + mermaidEscape(c.GetAction()) + "\"]\n")
+	}
+
+	for _, e := range s.renderedEdges() {
+		b.WriteString("  " + nodes[e.Source] + " --> " + nodes[e.Destination] + "\n")
+	}
+
+	for _, state := range []string{STATUSWAITING, STATUSQUEUED, STATUSRUNNING, STATUSCOMPLETED, STATUSERRORED, STATUSCANCELLED, STATUSPAUSED, STATUSSKIPPED} {
+		if len(states[state]) < 1 {
+			continue
+		}
+
+		b.WriteString("  classDef " + state + " fill:" + stateColours[state] + "\n")
+		b.WriteString("  class " + strings.Join(states[state], ",") + " " + state + "\n")
+	}
+
+	return b.String()
+}
+
+// SVG : renders the graph as an svg image, with every change placed on a row
+// below all of its dependencies, labelled by its action and coloured by its state
+func (s Scheduler) SVG() string {
+	var b bytes.Buffer
+
+	ids := []string{"start"}
+	labels := map[string]string{"start": "start", "end": "end"}
+	colours := map[string]string{"start": stateColours[STATUSWAITING], "end": stateColours[STATUSWAITING]}
+
+	for _, c := range s.graph.Changes {
+		ids = append(ids, c.GetID())
+		labels[c.GetID()] = c.GetID() + " (" + c.GetAction() + ")"
+		colours[c.GetID()] = stateColour(c.GetState())
+	}
+	ids = append(ids, "end")
+
+	edges := s.renderedEdges()
+
+	// every node is placed one row below the deepest of its dependencies
+	rows := make(map[string]int)
+	for i := 0; i < len(ids); i++ {
+		for _, e := range edges {
+			if rows[e.Destination] < rows[e.Source]+1 {
+				rows[e.Destination] = rows[e.Source] + 1
+			}
+		}
+	}
+
+	x := make(map[string]int)
+	y := make(map[string]int)
+	columns := make(map[int]int)
+	width, height := 0, 0
+
+	for _, id := range ids {
+		x[id] = SVGGAP + columns[rows[id]]*(SVGNODEWIDTH+SVGGAP)
+		y[id] = SVGGAP + rows[id]*(SVGNODEHEIGHT+SVGGAP)
+		columns[rows[id]]++
+
+		if x[id]+SVGNODEWIDTH+SVGGAP > width {
+			width = x[id] + SVGNODEWIDTH + SVGGAP
+		}
+		if y[id]+SVGNODEHEIGHT+SVGGAP > height {
+			height = y[id] + SVGNODEHEIGHT + SVGGAP
+		}
+	}
+
+	b.WriteString(`<svg xmlns="http://www.w3.org/2000/svg" width="` + strconv.Itoa(width) + `" height="` + strconv.Itoa(height) + `" font-family="sans-serif" font-size="12">` + "\n")
+	b.WriteString(`  <defs><marker id="arrow" viewBox="0 0 10 10" refX="10" refY="5" markerWidth="6" markerHeight="6" orient="auto"><path d="M0,0 L10,5 L0,10 z"/></marker></defs>` + "\n")
+
+	for _, e := range edges {
+		b.WriteString(`  <line x1="` + strconv.Itoa(x[e.Source]+SVGNODEWIDTH/2) + `" y1="` + strconv.Itoa(y[e.Source]+SVGNODEHEIGHT))
+		b.WriteString(`" x2="` + strconv.Itoa(x[e.Destination]+SVGNODEWIDTH/2) + `" y2="` + strconv.Itoa(y[e.Destination]))
+		b.WriteString(`" stroke="black" marker-end="url(#arrow)"/>` + "\n")
+	}
+
+	for _, id := range ids {
+		rx := "4"
+		if id == "start" || id == "end" {
+			rx = strconv.Itoa(SVGNODEHEIGHT / 2)
+		}
+
+		b.WriteString(`  <rect x="` + strconv.Itoa(x[id]) + `" y="` + strconv.Itoa(y[id]))
+		b.WriteString(`" width="` + strconv.Itoa(SVGNODEWIDTH) + `" height="` + strconv.Itoa(SVGNODEHEIGHT))
+		b.WriteString(`" rx="` + rx + `" fill="` + colours[id] + `" stroke="black"/>` + "\n")
+		b.WriteString(`  <text x="` + strconv.Itoa(x[id]+SVGNODEWIDTH/2) + `" y="` + strconv.Itoa(y[id]+SVGNODEHEIGHT/2))
+		b.WriteString(`" text-anchor="middle" dominant-baseline="middle">` + html.EscapeString(labels[id]) + "</text>\n")
+	}
+
+	b.WriteString("</svg>\n")
+
+	return b.String()
+}
+
+// renderedEdges : edges between the changes of the graph, and its start and end
+func (s Scheduler) renderedEdges() []graph.Edge {
+	var edges []graph.Edge
+
+	nodes := map[string]bool{"start": true, "end": true}
+	for _, c := range s.graph.Changes {
+		nodes[c.GetID()] = true
+	}
+
+	for _, e := range s.graph.Edges {
+		if nodes[e.Source] && nodes[e.Destination] {
+			edges = append(edges, e)
+		}
+	}
+
+	return edges
+}
+
+// mermaidEscape : escapes the characters mermaid can not show on a label
+func mermaidEscape(s string) string {
+	return strings.Replace(s, "\"", "#quot;", -1)
+}
+
+// render : replies with the graph of the build the message refers
+// to, rendered on the requested format
+func (s *Subscriber) render(m *Message) {
+	format, _ := m.data["format"].(string)
+
+	scheduler, err := s.loadBuild(m.getServiceID())
+	if err != nil {
+		respond(m, "error", map[string]interface{}{"id": m.getServiceID(), "error": err.Error()})
+		return
+	}
+
+	rendered, err := scheduler.Render(format)
+	if err != nil {
+		respond(m, "error", map[string]interface{}{"id": m.getServiceID(), "error": err.Error()})
+		return
+	}
+
+	if format == "" {
+		format = "dot"
+	}
+
+	respond(m, "done", map[string]interface{}{
+		"id":     scheduler.graph.ID,
+		"format": format,
+		"graph":  rendered,
+	})
+}
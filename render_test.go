@@ -0,0 +1,81 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package main
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestRender(t *testing.T) {
+	Convey("Given a build in progress", t, func() {
+		s := Scheduler{graph: loadTestMapping("test")}
+		s.graph.ComponentAll("instance::db-1").SetState(STATUSCOMPLETED)
+		s.graph.ComponentAll("instance::db-2").SetState(STATUSRUNNING)
+
+		Convey("When rendering it as dot", func() {
+			dot, err := s.Render("dot")
+
+			Convey("It should label and colour every change", func() {
+				So(err, ShouldBeNil)
+				So(dot, ShouldStartWith, "digraph \"test\" {\n")
+				So(dot, ShouldContainSubstring, `"instance::db-1" [label="instance::db-1\nupdate", fillcolor="#a5d6a7"];`)
+				So(dot, ShouldContainSubstring, `"instance::db-2" [label="instance::db-2\nupdate", fillcolor="#90caf9"];`)
+				So(dot, ShouldContainSubstring, `"network::web-new" [label="network::web-new\ncreate", fillcolor="#ffffff"];`)
+			})
+
+			Convey("It should include its edges", func() {
+				So(dot, ShouldContainSubstring, `"start" -> "instance::db-1";`)
+				So(dot, ShouldContainSubstring, `"instance::db-1" -> "instance::db-2";`)
+				So(dot, ShouldContainSubstring, `"instance::db-2" -> "end";`)
+			})
+		})
+
+		Convey("When rendering it as mermaid", func() {
+			mermaid, err := s.Render("mermaid")
+
+			Convey("It should label every change and class it by its state", func() {
+				So(err, ShouldBeNil)
+				So(mermaid, ShouldStartWith, "graph TD\n")
+				So(mermaid, ShouldContainSubstring, "c4[\"instance::db-1<br/>update\"]")
+				So(mermaid, ShouldContainSubstring, "classDef completed fill:#a5d6a7\n  class c4 completed\n")
+				So(mermaid, ShouldContainSubstring, "class c5 running\n")
+			})
+
+			Convey("It should include its edges", func() {
+				So(mermaid, ShouldContainSubstring, "start --> c4\n")
+				So(mermaid, ShouldContainSubstring, "c4 --> c5\n")
+				So(mermaid, ShouldContainSubstring, "c5 --> finish\n")
+			})
+		})
+
+		Convey("When rendering it as svg", func() {
+			svg, err := s.Render("svg")
+
+			Convey("It should label and colour every change", func() {
+				So(err, ShouldBeNil)
+				So(svg, ShouldStartWith, "<svg ")
+				So(svg, ShouldEndWith, "</svg>\n")
+				So(svg, ShouldContainSubstring, `<rect x="260" y="100" width="200" height="40" rx="4" fill="#a5d6a7" stroke="black"/>`)
+				So(svg, ShouldContainSubstring, `<text x="360" y="120" text-anchor="middle" dominant-baseline="middle">instance::db-1 (update)</text>`)
+			})
+
+			Convey("It should place every change below its dependencies", func() {
+				So(svg, ShouldContainSubstring, `<line x1="130" y1="70" x2="360" y2="100" stroke="black" marker-end="url(#arrow)"/>`)
+				So(svg, ShouldContainSubstring, `<line x1="360" y1="140" x2="820" y2="170" stroke="black" marker-end="url(#arrow)"/>`)
+				So(svg, ShouldContainSubstring, `<text x="130" y="260" text-anchor="middle" dominant-baseline="middle">end</text>`)
+			})
+		})
+
+		Convey("When rendering it on an unknown format", func() {
+			_, err := s.Render("png")
+
+			Convey("It should return an error", func() {
+				So(err, ShouldEqual, ErrUnsupportedFormat)
+			})
+		})
+	})
+}
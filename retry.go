@@ -0,0 +1,130 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"time"
+
+	graph "gopkg.in/r3labs/graph.v2"
+)
+
+// MAXRETRYBACKOFF : maximum time to wait before retrying a component
+const MAXRETRYBACKOFF = time.Minute * 10
+
+// Retry : number of times a failed component is retried, and the
+// time to wait before its first retry. The wait is doubled on every attempt
+type Retry struct {
+	Retries int    `json:"retries"`
+	Backoff string `json:"backoff"`
+}
+
+// ComponentRetry : retry settings for specific components. Only the
+// settings that are set override the less specific ones
+type ComponentRetry struct {
+	Retries *int   `json:"retries"`
+	Backoff string `json:"backoff"`
+}
+
+// RetryPolicy : global retry settings, along with the settings for specific
+// component types and providers, keyed by "type", "provider" or "type.provider"
+type RetryPolicy struct {
+	Retry
+	Components map[string]ComponentRetry `json:"components"`
+}
+
+// retryPolicy : gets the retry policy from the environment. By
+// default failed components are not retried
+func retryPolicy() *RetryPolicy {
+	var p RetryPolicy
+
+	data := os.Getenv("SCHEDULER_RETRY_POLICY")
+	if data == "" {
+		return &p
+	}
+
+	err := json.Unmarshal([]byte(data), &p)
+	if err != nil {
+		logger.Error("invalid retry policy: " + err.Error())
+		return &RetryPolicy{}
+	}
+
+	return &p
+}
+
+// For : returns the number of retries and backoff of a component, the
+// component's own '_retries' and '_retry_backoff' fields take precedence
+func (p *RetryPolicy) For(c graph.Component) (int, time.Duration) {
+	r := p.Retry
+
+	for _, key := range []string{c.GetProvider(), c.GetType(), c.GetType() + "." + c.GetProvider()} {
+		cr, ok := p.Components[key]
+		if !ok {
+			continue
+		}
+
+		if cr.Retries != nil {
+			r.Retries = *cr.Retries
+		}
+		if cr.Backoff != "" {
+			r.Backoff = cr.Backoff
+		}
+	}
+
+	retries := r.Retries
+	backoff, _ := time.ParseDuration(r.Backoff)
+
+	gc := c.(*graph.GenericComponent)
+
+	if v, ok := (*gc)["_retries"].(float64); ok {
+		retries = int(v)
+	}
+
+	switch v := (*gc)["_retry_backoff"].(type) {
+	case float64:
+		backoff = time.Duration(v * float64(time.Second))
+	case string:
+		if d, err := time.ParseDuration(v); err == nil {
+			backoff = d
+		}
+	}
+
+	return retries, backoff
+}
+
+// retryBackoff : time to wait before retrying a component
+// that has failed the given number of attempts
+func retryBackoff(backoff time.Duration, attempts int) time.Duration {
+	for i := 1; i < attempts && backoff < MAXRETRYBACKOFF; i++ {
+		backoff = backoff * 2
+	}
+
+	if backoff > MAXRETRYBACKOFF {
+		return MAXRETRYBACKOFF
+	}
+
+	return backoff
+}
+
+// getAttempts : number of times a component has been sent
+func getAttempts(c graph.Component) int {
+	gc := c.(*graph.GenericComponent)
+
+	switch v := (*gc)["_attempts"].(type) {
+	case float64:
+		return int(v)
+	case int:
+		return v
+	}
+
+	return 0
+}
+
+// setAttempts : records the number of times a component has been sent
+func setAttempts(c graph.Component, attempts int) {
+	gc := c.(*graph.GenericComponent)
+	(*gc)["_attempts"] = attempts
+}
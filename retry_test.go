@@ -0,0 +1,96 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package main
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+	graph "gopkg.in/r3labs/graph.v2"
+)
+
+func TestRetryPolicy(t *testing.T) {
+	Convey("Given a retry policy", t, func() {
+		two, three, four := 2, 3, 4
+
+		p := RetryPolicy{
+			Retry: Retry{Retries: 1, Backoff: "1s"},
+			Components: map[string]ComponentRetry{
+				"aws":          {Retries: &two},
+				"instance":     {Retries: &three, Backoff: "5s"},
+				"instance.aws": {Retries: &four},
+				"firewall":     {Backoff: "3s"},
+			},
+		}
+
+		c := serviceComponent("network::web-new", "service-1", STATUSERRORED)
+		gc := c.(*graph.GenericComponent)
+
+		Convey("When a component has no specific policy", func() {
+			(*gc)["_provider"] = "azure"
+			(*gc)["_component"] = "network"
+			retries, backoff := p.For(c)
+			Convey("It should use the global policy", func() {
+				So(retries, ShouldEqual, 1)
+				So(backoff, ShouldEqual, time.Second)
+			})
+		})
+
+		Convey("When a component's provider has a policy", func() {
+			(*gc)["_provider"] = "aws"
+			(*gc)["_component"] = "network"
+			retries, backoff := p.For(c)
+			Convey("It should use the provider's policy", func() {
+				So(retries, ShouldEqual, 2)
+				So(backoff, ShouldEqual, time.Second)
+			})
+		})
+
+		Convey("When a component's type only sets its backoff", func() {
+			(*gc)["_provider"] = "aws"
+			(*gc)["_component"] = "firewall"
+			retries, backoff := p.For(c)
+			Convey("It should keep the retries of the less specific policies", func() {
+				So(retries, ShouldEqual, 2)
+				So(backoff, ShouldEqual, time.Second*3)
+			})
+		})
+
+		Convey("When a component's type and provider have a policy", func() {
+			(*gc)["_provider"] = "aws"
+			(*gc)["_component"] = "instance"
+			retries, backoff := p.For(c)
+			Convey("It should use the most specific policy", func() {
+				So(retries, ShouldEqual, 4)
+				So(backoff, ShouldEqual, time.Second*5)
+			})
+		})
+
+		Convey("When a component defines its own policy", func() {
+			(*gc)["_provider"] = "aws"
+			(*gc)["_component"] = "instance"
+			(*gc)["_retries"] = float64(0)
+			(*gc)["_retry_backoff"] = "1m"
+			retries, backoff := p.For(c)
+			Convey("It should take precedence", func() {
+				So(retries, ShouldEqual, 0)
+				So(backoff, ShouldEqual, time.Minute)
+			})
+		})
+	})
+
+	Convey("Given a retry backoff", t, func() {
+		Convey("It should double on every attempt", func() {
+			So(retryBackoff(time.Second, 1), ShouldEqual, time.Second)
+			So(retryBackoff(time.Second, 2), ShouldEqual, time.Second*2)
+			So(retryBackoff(time.Second, 4), ShouldEqual, time.Second*8)
+		})
+
+		Convey("It should not exceed the maximum backoff", func() {
+			So(retryBackoff(time.Minute, 10), ShouldEqual, MAXRETRYBACKOFF)
+		})
+	})
+}
@@ -19,11 +19,25 @@ const (
 	STATUSRUNNING = "running"
 	// STATUSCOMPLETED : Completed status
 	STATUSCOMPLETED = "completed"
+	// STATUSCANCELLED : Cancelled status
+	STATUSCANCELLED = "cancelled"
+	// STATUSPAUSED : Paused status
+	STATUSPAUSED = "paused"
+	// STATUSSKIPPED : Skipped status, for components that depend on a failed one
+	STATUSSKIPPED = "skipped"
+	// STATUSQUEUED : Queued status, for components waiting for a free slot to run
+	STATUSQUEUED = "queued"
 )
 
+// ErrProvisioningFailed : returned once a component has failed
+// and no other components are running
+var ErrProvisioningFailed = errors.New("service provisioning has failed with an error")
+
 // Scheduler : Manages the scehuduling of verticies/components based on a directed graph.
 type Scheduler struct {
-	graph *graph.Graph
+	graph    *graph.Graph
+	revision int
+	slots    *Concurrency
 }
 
 // Load : loads a graph
@@ -62,15 +76,14 @@ func (s Scheduler) Receive(c graph.Component) ([]graph.Component, error) {
 
 	s.updateChange(c)
 
-	// Allow the other running components to finish before returning an error
-	if c.GetState() == STATUSERRORED && s.Running() != true {
-		return []graph.Component{}, errors.New("service provisioning has failed with an error")
+	// Allow the other running components to finish before returning an error.
+	// A build that continues on error keeps running its queued components
+	if c.GetState() == STATUSERRORED && s.Running() != true && !s.ContinueOnError() {
+		return []graph.Component{}, ErrProvisioningFailed
 	}
 
-	next := s.next(c)
-	for _, c := range next {
-		c.SetState(STATUSRUNNING)
-	}
+	// components that were queued take precedence over the new ones
+	next := append(s.Dequeue(), s.admit(s.next(c))...)
 
 	return next, nil
 }
@@ -108,14 +121,214 @@ func (s Scheduler) Running() bool {
 	return false
 }
 
+// Cancelled : returns true if one component has been cancelled
+func (s Scheduler) Cancelled() bool {
+	for _, c := range s.graph.Changes {
+		if c.GetState() == STATUSCANCELLED {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Paused : returns true if one component has been paused
+func (s Scheduler) Paused() bool {
+	for _, c := range s.graph.Changes {
+		if c.GetState() == STATUSPAUSED {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Queued : returns true if one component is waiting for a free slot to run
+func (s Scheduler) Queued() bool {
+	for _, c := range s.graph.Changes {
+		if c.GetState() == STATUSQUEUED {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Cancel : cancels all components that have not been scheduled yet, and returns them
+func (s Scheduler) Cancel() []graph.Component {
+	var cs []graph.Component
+
+	for _, c := range s.graph.Changes {
+		if s.schedulable(c) || c.GetState() == STATUSPAUSED || c.GetState() == STATUSQUEUED {
+			c.SetState(STATUSCANCELLED)
+			cs = append(cs, c)
+		}
+	}
+
+	return cs
+}
+
+// Pause : pauses all components that have not been scheduled yet, and returns them
+func (s Scheduler) Pause() []graph.Component {
+	var cs []graph.Component
+
+	for _, c := range s.graph.Changes {
+		if s.schedulable(c) || c.GetState() == STATUSQUEUED {
+			c.SetState(STATUSPAUSED)
+			cs = append(cs, c)
+		}
+	}
+
+	return cs
+}
+
+// Resume : sets all paused components back to waiting, and returns them
+func (s Scheduler) Resume() []graph.Component {
+	var cs []graph.Component
+
+	for _, c := range s.graph.Changes {
+		if c.GetState() == STATUSPAUSED {
+			c.SetState(STATUSWAITING)
+			cs = append(cs, c)
+		}
+	}
+
+	return cs
+}
+
+// Unblocked : returns all components waiting to be scheduled whose
+// dependencies have been satisfied, and sets them as running or queued
+func (s Scheduler) Unblocked() []graph.Component {
+	if s.halted() {
+		return []graph.Component{}
+	}
+
+	return append(s.Dequeue(), s.admit(s.Ready())...)
+}
+
+// Ready : returns all components waiting to be scheduled whose dependencies
+// have been satisfied, in order of priority, without scheduling them
+func (s Scheduler) Ready() []graph.Component {
+	var cs []graph.Component
+
+	if s.halted() {
+		return cs
+	}
+
+	for _, c := range s.graph.Changes {
+		if s.schedulable(c) && s.ready(c) {
+			cs = append(cs, c)
+		}
+	}
+
+	return s.prioritize(cs)
+}
+
+// Dequeue : returns all queued components that have got a free slot to run,
+// and sets them as running
+func (s Scheduler) Dequeue() []graph.Component {
+	var cs []graph.Component
+
+	if s.halted() {
+		return cs
+	}
+
+	var queued []graph.Component
+	for _, c := range s.graph.Changes {
+		if c.GetState() == STATUSQUEUED {
+			queued = append(queued, c)
+		}
+	}
+
+	for _, c := range s.prioritize(queued) {
+		if s.slots.Acquire(s.graph.ID, c) {
+			c.SetState(STATUSRUNNING)
+			cs = append(cs, c)
+		}
+	}
+
+	return cs
+}
+
+// admit : sets components as running if there is a free slot for
+// them to run, or as queued otherwise, in order of priority
+func (s Scheduler) admit(cs []graph.Component) []graph.Component {
+	for _, c := range s.prioritize(cs) {
+		if s.slots.Acquire(s.graph.ID, c) {
+			c.SetState(STATUSRUNNING)
+		} else {
+			c.SetState(STATUSQUEUED)
+		}
+	}
+
+	return cs
+}
+
+// halted : returns true if no other components should be scheduled
+func (s Scheduler) halted() bool {
+	return s.Errored() && !s.ContinueOnError() || s.Paused()
+}
+
+// ContinueOnError : returns true if the build should keep scheduling
+// the components that do not depend on a failed one
+func (s Scheduler) ContinueOnError() bool {
+	for _, c := range s.graph.Changes {
+		gc, ok := c.(*graph.GenericComponent)
+		if ok && (*gc)["_continue_on_error"] == true {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Skip : skips all components waiting to be scheduled that
+// depend on a failed component, and returns them
+func (s Scheduler) Skip(c graph.Component) []graph.Component {
+	var cs []graph.Component
+
+	for _, n := range *s.neighbours(c.GetID()) {
+		if !s.schedulable(n) && n.GetState() != STATUSPAUSED && n.GetState() != STATUSQUEUED {
+			continue
+		}
+
+		n.SetState(STATUSSKIPPED)
+		cs = append(cs, n)
+		cs = append(cs, s.Skip(n)...)
+	}
+
+	return cs
+}
+
+// Failures : returns the ids of all components that have failed or have been skipped
+func (s Scheduler) Failures() ([]string, []string) {
+	failed := []string{}
+	skipped := []string{}
+
+	for _, c := range s.graph.Changes {
+		switch c.GetState() {
+		case STATUSERRORED:
+			failed = append(failed, c.GetID())
+		case STATUSSKIPPED:
+			skipped = append(skipped, c.GetID())
+		}
+	}
+
+	return failed, skipped
+}
+
 func (s Scheduler) next(c graph.Component) []graph.Component {
 	var cs []graph.Component
 
-	if s.Errored() {
+	if s.halted() {
 		return cs
 	}
 
 	for _, n := range *s.neighbours(c.GetID()) {
+		if !s.schedulable(n) {
+			continue
+		}
+
 		if s.ready(n) {
 			cs = append(cs, n)
 		}
@@ -134,6 +347,16 @@ func (s Scheduler) ready(c graph.Component) bool {
 	return true
 }
 
+// schedulable : returns true if a component is waiting to be scheduled
+func (s Scheduler) schedulable(c graph.Component) bool {
+	switch c.GetState() {
+	case STATUSRUNNING, STATUSCOMPLETED, STATUSERRORED, STATUSCANCELLED, STATUSPAUSED, STATUSSKIPPED, STATUSQUEUED:
+		return false
+	}
+
+	return true
+}
+
 func (s Scheduler) origins(id string) *graph.Neighbours {
 	var n graph.Neighbours
 
@@ -158,6 +381,17 @@ func (s Scheduler) neighbours(id string) *graph.Neighbours {
 	return n.Unique()
 }
 
+// change : returns the change with the given id, or nil if there is none
+func (s Scheduler) change(id string) graph.Component {
+	for _, c := range s.graph.Changes {
+		if c.GetID() == id {
+			return c
+		}
+	}
+
+	return nil
+}
+
 func (s Scheduler) updateChange(c graph.Component) {
 	for i := 0; i < len(s.graph.Changes); i++ {
 		if s.graph.Changes[i].GetID() == c.GetID() {
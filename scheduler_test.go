@@ -218,6 +218,19 @@ func TestScheduler(t *testing.T) {
 					})
 				})
 
+				Convey("Which has dependants that have already been scheduled", func() {
+					s.graph.ComponentAll("instance::web-new-1").SetState(STATUSRUNNING)
+					c := s.graph.ComponentAll("network::web-new")
+					c.SetState(STATUSCOMPLETED)
+					components, err := s.Receive(c)
+					Convey("It should only return the dependants that are still waiting", func() {
+						So(err, ShouldBeNil)
+						So(len(components), ShouldEqual, 2)
+						So(components[0].GetID(), ShouldEqual, "instance::web-new-2")
+						So(components[1].GetID(), ShouldEqual, "instance::web-new-3")
+					})
+				})
+
 				Convey("Which has waiting or running dependencies", func() {
 					c := s.graph.ComponentAll("instance::web-1")
 					c.SetState(STATUSCOMPLETED)
@@ -266,6 +279,107 @@ func TestScheduler(t *testing.T) {
 					})
 				})
 			})
+
+			Convey("And the build is cancelled", func() {
+				s.graph.ComponentAll("network::web-new").SetState(STATUSRUNNING)
+				s.graph.ComponentAll("instance::db-1").SetState(STATUSCOMPLETED)
+				cancelled := s.Cancel()
+
+				Convey("It should cancel all components that have not been scheduled", func() {
+					So(len(cancelled), ShouldEqual, 8)
+					So(s.Cancelled(), ShouldBeTrue)
+					So(s.graph.ComponentAll("network::web-new").GetState(), ShouldEqual, STATUSRUNNING)
+					So(s.graph.ComponentAll("instance::db-1").GetState(), ShouldEqual, STATUSCOMPLETED)
+					So(s.graph.ComponentAll("instance::db-2").GetState(), ShouldEqual, STATUSCANCELLED)
+				})
+
+				Convey("And a running component completes", func() {
+					c := cp(s.graph.ComponentAll("network::web-new"))
+					c.SetState(STATUSCOMPLETED)
+					components, err := s.Receive(c)
+
+					Convey("It should not schedule any other component", func() {
+						So(err, ShouldBeNil)
+						So(len(components), ShouldEqual, 0)
+						So(s.Running(), ShouldBeFalse)
+						So(s.Done(), ShouldBeFalse)
+					})
+				})
+			})
+
+			Convey("And the build is paused", func() {
+				s.graph.ComponentAll("network::web-new").SetState(STATUSRUNNING)
+				paused := s.Pause()
+
+				Convey("It should pause all components that have not been scheduled", func() {
+					So(len(paused), ShouldEqual, 9)
+					So(s.Paused(), ShouldBeTrue)
+					So(s.graph.ComponentAll("network::web-new").GetState(), ShouldEqual, STATUSRUNNING)
+					So(s.graph.ComponentAll("instance::web-new-1").GetState(), ShouldEqual, STATUSPAUSED)
+				})
+
+				Convey("And a running component completes", func() {
+					c := cp(s.graph.ComponentAll("network::web-new"))
+					c.SetState(STATUSCOMPLETED)
+					components, err := s.Receive(c)
+
+					Convey("It should not schedule any other component", func() {
+						So(err, ShouldBeNil)
+						So(len(components), ShouldEqual, 0)
+					})
+
+					Convey("And the build is resumed", func() {
+						resumed := s.Resume()
+						components := s.Unblocked()
+
+						Convey("It should schedule all components whose dependencies are satisfied", func() {
+							So(len(resumed), ShouldEqual, 9)
+							So(s.Paused(), ShouldBeFalse)
+							So(len(components), ShouldEqual, 7)
+							So(s.graph.ComponentAll("instance::web-new-1").GetState(), ShouldEqual, STATUSRUNNING)
+							So(s.graph.ComponentAll("instance::db-2").GetState(), ShouldEqual, STATUSWAITING)
+						})
+					})
+				})
+			})
+
+			Convey("And the build continues on error", func() {
+				for _, c := range s.graph.Changes {
+					(*c.(*graph.GenericComponent))["_continue_on_error"] = true
+				}
+
+				Convey("And it receives an errored component", func() {
+					s.graph.ComponentAll("instance::db-1").SetState(STATUSRUNNING)
+					c := cp(s.graph.ComponentAll("network::web-new"))
+					c.SetState(STATUSERRORED)
+					_, _ = s.Receive(c)
+					skipped := s.Skip(c)
+
+					Convey("It should skip all components that depend on it", func() {
+						So(s.ContinueOnError(), ShouldBeTrue)
+						So(len(skipped), ShouldEqual, 3)
+						So(s.graph.ComponentAll("instance::web-new-1").GetState(), ShouldEqual, STATUSSKIPPED)
+					})
+
+					Convey("And an independent component completes", func() {
+						c := cp(s.graph.ComponentAll("instance::db-1"))
+						c.SetState(STATUSCOMPLETED)
+						components, err := s.Receive(c)
+
+						Convey("It should keep scheduling its dependants", func() {
+							So(err, ShouldBeNil)
+							So(len(components), ShouldEqual, 1)
+							So(components[0].GetID(), ShouldEqual, "instance::db-2")
+						})
+
+						Convey("It should report the failed and skipped components", func() {
+							failed, skipped := s.Failures()
+							So(failed, ShouldResemble, []string{"network::web-new"})
+							So(skipped, ShouldResemble, []string{"instance::web-new-1", "instance::web-new-2", "instance::web-new-3"})
+						})
+					})
+				})
+			})
 		})
 
 		Convey("When loading a new import graph", func() {
@@ -0,0 +1,129 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package main
+
+import (
+	"errors"
+	"os"
+	"time"
+
+	"github.com/nats-io/go-nats"
+)
+
+// DEFAULTSHUTDOWNTIMEOUT : time messages in progress have to
+// be processed before the scheduler stops
+const DEFAULTSHUTDOWNTIMEOUT = 30 * time.Second
+
+// DRAINPOLLINTERVAL : how often subscriptions and the nats
+// connection are checked while they are being drained
+const DRAINPOLLINTERVAL = 50 * time.Millisecond
+
+// ErrShutdownTimeout : returned when the scheduler stops before
+// all messages in progress have been processed
+var ErrShutdownTimeout = errors.New("shutdown timed out before all messages were processed")
+
+// shutdownTimeout : gets the shutdown timeout from the environment
+func shutdownTimeout() time.Duration {
+	v := os.Getenv("SCHEDULER_SHUTDOWN_TIMEOUT")
+	if v == "" {
+		return DEFAULTSHUTDOWNTIMEOUT
+	}
+
+	timeout, err := time.ParseDuration(v)
+	if err != nil {
+		logger.Error("invalid shutdown timeout: " + v)
+		return DEFAULTSHUTDOWNTIMEOUT
+	}
+
+	return timeout
+}
+
+// Shutdown : drains all subscriptions, so every message already delivered
+// is handled, and waits for them to be processed, so their changes are
+// stored and their components sent, before draining the nats connection
+func (s *Subscriber) Shutdown(timeout time.Duration) error {
+	var err error
+
+	deadline := time.Now().Add(timeout)
+
+	s.mu.Lock()
+	conn := s.conn
+	subs := s.subs
+	s.subs = nil
+	s.mu.Unlock()
+
+	for _, sub := range subs {
+		if derr := sub.Drain(); derr != nil {
+			logger.Error("could not drain subscription: " + derr.Error())
+		}
+	}
+
+	if !drained(subs, deadline) {
+		err = ErrShutdownTimeout
+	}
+
+	// no more messages are handled once subscriptions have been drained
+	s.mu.Lock()
+	s.closing = true
+	s.mu.Unlock()
+
+	// messages being handled may still queue others, so they are waited first
+	if !wait(&s.handling, time.Until(deadline)) || !s.queue.Wait(time.Until(deadline)) {
+		err = ErrShutdownTimeout
+	}
+
+	// acknowledgements of durable messages are flushed along with the connection
+	if conn != nil {
+		if derr := conn.Drain(); derr != nil {
+			logger.Error("could not drain nats connection: " + derr.Error())
+		}
+		if !closed(conn, flushTimeout(deadline)) {
+			logger.Error("could not drain nats connection in time")
+			conn.Close()
+		}
+	}
+
+	return err
+}
+
+// drained : waits until all subscriptions have delivered the
+// messages they had pending, returning false on timeout
+func drained(subs []*nats.Subscription, deadline time.Time) bool {
+	for _, sub := range subs {
+		for sub.IsValid() {
+			if time.Now().After(deadline) {
+				return false
+			}
+			time.Sleep(DRAINPOLLINTERVAL)
+		}
+	}
+
+	return true
+}
+
+// closed : waits until a draining connection has been closed,
+// returning false on timeout
+func closed(conn *nats.Conn, timeout time.Duration) bool {
+	deadline := time.Now().Add(timeout)
+
+	for !conn.IsClosed() {
+		if time.Now().After(deadline) {
+			return false
+		}
+		time.Sleep(DRAINPOLLINTERVAL)
+	}
+
+	return true
+}
+
+// flushTimeout : time left to flush before the deadline, allowing
+// at least a second to flush all published messages
+func flushTimeout(deadline time.Time) time.Duration {
+	if left := time.Until(deadline); left > time.Second {
+		return left
+	}
+
+	return time.Second
+}
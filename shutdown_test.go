@@ -0,0 +1,80 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package main
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/nats-io/go-nats"
+	. "github.com/smartystreets/goconvey/convey"
+	graph "gopkg.in/r3labs/graph.v2"
+)
+
+// slowStore : a memory store that takes a while to store each change
+type slowStore struct {
+	*MemoryStore
+	delay time.Duration
+}
+
+// SetChange : stores the change once the delay has passed
+func (s *slowStore) SetChange(c graph.Component, revision int) (int, error) {
+	time.Sleep(s.delay)
+	return s.MemoryStore.SetChange(c, revision)
+}
+
+func TestShutdown(t *testing.T) {
+	Convey("Given a build with a running component", t, func() {
+		_, restore := capturePublished()
+		Reset(restore)
+
+		g := loadTestMapping("test")
+		for _, c := range g.Changes {
+			(*c.(*graph.GenericComponent))["service"] = g.ID
+		}
+		g.ComponentAll("instance::db-1").SetState(STATUSRUNNING)
+
+		memory := NewMemoryStore()
+		_, err := memory.SetMapping(g.ID, g, 0)
+		So(err, ShouldBeNil)
+
+		c := cp(g.ComponentAll("instance::db-1"))
+		c.SetState(STATUSCOMPLETED)
+		data, err := json.Marshal(c)
+		So(err, ShouldBeNil)
+
+		Convey("When shutting down while its result is being processed", func() {
+			s := NewSubscriber(&slowStore{MemoryStore: memory, delay: 50 * time.Millisecond}, nil)
+			Reset(func() { s.timeouts.Stop(g.ID, "instance::db-2") })
+
+			s.Handle(&nats.Msg{Subject: "instance.update.aws.done", Data: data})
+			err := s.Shutdown(time.Second)
+
+			Convey("It should process the result before returning", func() {
+				So(err, ShouldBeNil)
+				So(s.queue.Len(), ShouldEqual, 0)
+				So(storedChange(memory, g.ID, "instance::db-1").GetState(), ShouldEqual, STATUSCOMPLETED)
+				So(storedChange(memory, g.ID, "instance::db-2").GetState(), ShouldEqual, STATUSRUNNING)
+			})
+		})
+
+		Convey("When processing the result takes longer than the shutdown timeout", func() {
+			s := NewSubscriber(&slowStore{MemoryStore: memory, delay: 200 * time.Millisecond}, nil)
+			Reset(func() {
+				s.queue.Wait(time.Second)
+				s.timeouts.Stop(g.ID, "instance::db-2")
+			})
+
+			s.Handle(&nats.Msg{Subject: "instance.update.aws.done", Data: data})
+			err := s.Shutdown(50 * time.Millisecond)
+
+			Convey("It should return once timed out", func() {
+				So(err, ShouldEqual, ErrShutdownTimeout)
+				So(storedChange(memory, g.ID, "instance::db-1").GetState(), ShouldEqual, STATUSRUNNING)
+			})
+		})
+	})
+}
@@ -0,0 +1,63 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package main
+
+import (
+	"errors"
+	"os"
+
+	graph "gopkg.in/r3labs/graph.v2"
+)
+
+// ErrConflict : returned when the stored mapping has been modified
+// since the revision a change was based on
+var ErrConflict = errors.New("mapping revision conflict")
+
+// ErrMappingNotFound : returned when there is no mapping stored for a service
+var ErrMappingNotFound = errors.New("mapping not found")
+
+// Store : persists the mapping of a service build and the state of its
+// components. All updates take the revision of the mapping they are based
+// on and return the revision of the mapping once they have been applied.
+// A revision of zero skips the revision check.
+type Store interface {
+	GetMapping(id string) (map[string]interface{}, error)
+	SetMapping(id string, mapping *graph.Graph, revision int) (int, error)
+	SetComponent(c graph.Component, revision int) (int, error)
+	DeleteComponent(c graph.Component, revision int) (int, error)
+	SetChange(c graph.Component, revision int) (int, error)
+	DeleteChange(c graph.Component, revision int) (int, error)
+}
+
+// NewStore : returns the store configured by the environment. Supported
+// stores are 'nats' (service-store, the default), 'memory' and 'file'
+func NewStore() (Store, error) {
+	switch os.Getenv("SCHEDULER_STORE") {
+	case "", "nats":
+		return NewNatsStore(nc), nil
+	case "memory":
+		return NewMemoryStore(), nil
+	case "file":
+		path := os.Getenv("SCHEDULER_STORE_PATH")
+		if path == "" {
+			path = "scheduler.db"
+		}
+		return NewFileStore(path)
+	}
+
+	return nil, errors.New("unsupported store: " + os.Getenv("SCHEDULER_STORE"))
+}
+
+// getRevision : returns the revision of a mapping, zero if it has none
+func getRevision(mapping map[string]interface{}) int {
+	switch revision := mapping["revision"].(type) {
+	case float64:
+		return int(revision)
+	case int:
+		return revision
+	}
+
+	return 0
+}
@@ -0,0 +1,188 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+	graph "gopkg.in/r3labs/graph.v2"
+)
+
+func loadTestMapping(id string) *graph.Graph {
+	ms, err := loadjsongraph("./fixtures/test-graph.json")
+	if err != nil {
+		panic(err)
+	}
+
+	g := graph.New()
+	if err := g.Load(ms); err != nil {
+		panic(err)
+	}
+	g.ID = id
+
+	return g
+}
+
+func serviceComponent(id, service, state string) graph.Component {
+	c := fakeComponent(id)
+	c["service"] = service
+	c["_state"] = state
+
+	return graph.MapGenericComponent(c)
+}
+
+func TestMemoryStore(t *testing.T) {
+	Convey("Given a memory store", t, func() {
+		s := NewMemoryStore()
+
+		Convey("When getting a mapping that has not been stored", func() {
+			_, err := s.GetMapping("unknown")
+			Convey("It should return an error", func() {
+				So(err, ShouldEqual, ErrMappingNotFound)
+			})
+		})
+
+		Convey("When storing a new mapping", func() {
+			revision, err := s.SetMapping("service-1", loadTestMapping("service-1"), 0)
+			So(err, ShouldBeNil)
+
+			mapping, err := s.GetMapping("service-1")
+
+			Convey("It should return the mapping with its revision", func() {
+				So(err, ShouldBeNil)
+				So(revision, ShouldEqual, 1)
+				So(getRevision(mapping), ShouldEqual, 1)
+				So(len(mapping["changes"].([]interface{})), ShouldEqual, 10)
+			})
+
+			Convey("And updating a change based on the latest revision", func() {
+				c := serviceComponent("network::web-new", "service-1", STATUSRUNNING)
+				revision, err = s.SetChange(c, revision)
+
+				Convey("It should update the change and its revision", func() {
+					So(err, ShouldBeNil)
+					So(revision, ShouldEqual, 2)
+
+					mapping, _ := s.GetMapping("service-1")
+					g := graph.New()
+					So(g.Load(mapping), ShouldBeNil)
+					So(g.ComponentAll("network::web-new").GetState(), ShouldEqual, STATUSRUNNING)
+				})
+			})
+
+			Convey("And updating a change based on an old revision", func() {
+				_, err = s.SetChange(serviceComponent("network::web-new", "service-1", STATUSRUNNING), revision)
+				So(err, ShouldBeNil)
+
+				_, err = s.SetChange(serviceComponent("instance::db-1", "service-1", STATUSRUNNING), revision)
+
+				Convey("It should return a conflict", func() {
+					So(err, ShouldEqual, ErrConflict)
+				})
+			})
+
+			Convey("And storing and deleting components", func() {
+				revision, err = s.SetComponent(serviceComponent("network::web-new", "service-1", STATUSCOMPLETED), revision)
+				So(err, ShouldBeNil)
+				revision, err = s.DeleteComponent(serviceComponent("network::web", "service-1", STATUSCOMPLETED), revision)
+				So(err, ShouldBeNil)
+
+				Convey("It should update the mapping's components", func() {
+					mapping, _ := s.GetMapping("service-1")
+					g := graph.New()
+					So(g.Load(mapping), ShouldBeNil)
+					So(g.Component("network::web-new"), ShouldNotBeNil)
+					So(g.Component("network::web"), ShouldBeNil)
+					So(revision, ShouldEqual, 3)
+				})
+			})
+		})
+	})
+}
+
+func TestFileStore(t *testing.T) {
+	Convey("Given a file store", t, func() {
+		dir, err := ioutil.TempDir("", "scheduler")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+
+		path := filepath.Join(dir, "scheduler.db")
+
+		s, err := NewFileStore(path)
+		So(err, ShouldBeNil)
+
+		Convey("When a mapping is stored and the store is reopened", func() {
+			revision, err := s.SetMapping("service-1", loadTestMapping("service-1"), 0)
+			So(err, ShouldBeNil)
+			_, err = s.SetChange(serviceComponent("network::web-new", "service-1", STATUSRUNNING), revision)
+			So(err, ShouldBeNil)
+
+			rs, err := NewFileStore(path)
+			So(err, ShouldBeNil)
+
+			mapping, err := rs.GetMapping("service-1")
+
+			Convey("It should return the stored mapping", func() {
+				So(err, ShouldBeNil)
+				So(getRevision(mapping), ShouldEqual, 2)
+
+				g := graph.New()
+				So(g.Load(mapping), ShouldBeNil)
+				So(g.ComponentAll("network::web-new").GetState(), ShouldEqual, STATUSRUNNING)
+			})
+		})
+	})
+}
+
+func TestNatsStoreReply(t *testing.T) {
+	Convey("Given a reply of service-store to an update", t, func() {
+		Convey("When it carries the new revision", func() {
+			revision, err := parseReply([]byte(`{"revision":3}`), 2)
+
+			Convey("It should return the new revision", func() {
+				So(err, ShouldBeNil)
+				So(revision, ShouldEqual, 3)
+			})
+		})
+
+		Convey("When it is empty", func() {
+			revision, err := parseReply([]byte(``), 2)
+
+			Convey("It should keep the revision the update was based on", func() {
+				So(err, ShouldBeNil)
+				So(revision, ShouldEqual, 2)
+			})
+		})
+
+		Convey("When it reports a conflict", func() {
+			_, err := parseReply([]byte(`{"error":"conflict"}`), 2)
+
+			Convey("It should return a conflict", func() {
+				So(err, ShouldEqual, ErrConflict)
+			})
+		})
+
+		Convey("When it reports any other error", func() {
+			_, err := parseReply([]byte(`{"error":"not found"}`), 2)
+
+			Convey("It should return the error", func() {
+				So(err, ShouldNotBeNil)
+				So(err.Error(), ShouldEqual, "not found")
+			})
+		})
+
+		Convey("When it can not be understood", func() {
+			_, err := parseReply([]byte(`not json`), 2)
+
+			Convey("It should return an error", func() {
+				So(err, ShouldEqual, ErrInvalidReply)
+			})
+		})
+	})
+}
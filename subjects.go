@@ -0,0 +1,49 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package main
+
+import (
+	"os"
+	"strings"
+)
+
+// serviceSubjects : subjects of the messages that start and control builds
+var serviceSubjects = []string{"build.*", "scheduler.graph.render"}
+
+// subjects : subjects the scheduler subscribes to. By default, all build
+// messages and the results of all components, which can be limited to the
+// components of the providers listed on SCHEDULER_PROVIDERS. All subjects
+// can instead be listed on SCHEDULER_SUBJECTS
+func subjects() []string {
+	if v := os.Getenv("SCHEDULER_SUBJECTS"); v != "" {
+		return split(v)
+	}
+
+	providers := []string{"*"}
+	if v := os.Getenv("SCHEDULER_PROVIDERS"); v != "" {
+		providers = split(v)
+	}
+
+	subjects := append([]string{}, serviceSubjects...)
+	for _, provider := range providers {
+		subjects = append(subjects, "*.*."+provider+".done", "*.*."+provider+".error")
+	}
+
+	return subjects
+}
+
+// split : splits a comma separated list, ignoring empty values
+func split(v string) []string {
+	var values []string
+
+	for _, value := range strings.Split(v, ",") {
+		value = strings.TrimSpace(value)
+		if value != "" {
+			values = append(values, value)
+		}
+	}
+
+	return values
+}
@@ -0,0 +1,48 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package main
+
+import (
+	"os"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestSubjects(t *testing.T) {
+	Convey("Given a scheduler with the default configuration", t, func() {
+		Convey("When getting the subjects it subscribes to", func() {
+			Convey("It should subscribe to builds and the results of all components", func() {
+				So(subjects(), ShouldResemble, []string{"build.*", "scheduler.graph.render", "*.*.*.done", "*.*.*.error"})
+			})
+		})
+	})
+
+	Convey("Given a scheduler configured with a list of providers", t, func() {
+		os.Setenv("SCHEDULER_PROVIDERS", "aws, azure")
+		defer os.Unsetenv("SCHEDULER_PROVIDERS")
+
+		Convey("When getting the subjects it subscribes to", func() {
+			Convey("It should only subscribe to the results of their components", func() {
+				So(subjects(), ShouldResemble, []string{
+					"build.*", "scheduler.graph.render",
+					"*.*.aws.done", "*.*.aws.error",
+					"*.*.azure.done", "*.*.azure.error",
+				})
+			})
+		})
+	})
+
+	Convey("Given a scheduler configured with a list of subjects", t, func() {
+		os.Setenv("SCHEDULER_SUBJECTS", "build.*,instance.*.aws.done,")
+		defer os.Unsetenv("SCHEDULER_SUBJECTS")
+
+		Convey("When getting the subjects it subscribes to", func() {
+			Convey("It should only subscribe to them", func() {
+				So(subjects(), ShouldResemble, []string{"build.*", "instance.*.aws.done"})
+			})
+		})
+	})
+}
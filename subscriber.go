@@ -5,90 +5,698 @@
 package main
 
 import (
-	"errors"
-	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/nats-io/go-nats"
 	graph "gopkg.in/r3labs/graph.v2"
 )
 
-// subscriber : manages the subscription to all messages, and
+// CONFLICTRETRIES : number of times a message is reprocessed when
+// its mapping has been modified concurrently
+const CONFLICTRETRIES = 5
+
+// Subscriber : processes the messages received by the scheduler,
+// persisting the state of every build on its store
+type Subscriber struct {
+	mu         sync.Mutex
+	conn       *nats.Conn
+	subs       []*nats.Subscription
+	handling   sync.WaitGroup
+	closing    bool
+	store      Store
+	journal    *Journal
+	queue      *ServiceQueue
+	timeouts   *Timeouts
+	retries    *RetryPolicy
+	slots      *Concurrency
+	tracer     *Tracer
+	active     *ActiveBuilds
+	partitions Partitioning
+	subjects   []string
+	seen       *SeenMessages
+	jetstream  *JetStream
+	maxPending int
+}
+
+// NewSubscriber : Subscriber constructor. The journal is optional
+func NewSubscriber(store Store, journal *Journal) *Subscriber {
+	s := &Subscriber{store: store, journal: journal}
+	s.queue = NewServiceQueue(s.process)
+	s.timeouts = NewTimeouts(defaultTimeout(), timedOut)
+	s.retries = retryPolicy()
+	s.slots = concurrency()
+	s.active = NewActiveBuilds()
+	s.maxPending = maxPending()
+	s.partitions = partitioning()
+	s.subjects = subjects()
+	s.seen = NewSeenMessages(SEENMESSAGES)
+	s.jetstream = jetStream()
+
+	s.tracer = tracer()
+	if s.tracer != nil {
+		s.store = NewTracedStore(store, s.tracer)
+	}
+
+	return s
+}
+
+// Connect : sets the nats connection the scheduler reports its health on
+func (s *Subscriber) Connect(conn *nats.Conn) {
+	s.mu.Lock()
+	s.conn = conn
+	s.mu.Unlock()
+}
+
+// Listen : subscribes to the subjects of all messages processed by the scheduler,
+// and to the messages forwarded to its partition if there are more than one
+func (s *Subscriber) Listen(conn *nats.Conn) error {
+	err := s.partitions.validate()
+	if err != nil {
+		return err
+	}
+
+	if s.jetstream != nil && s.partitions.Count > 1 {
+		return ErrPartitionedJetStream
+	}
+
+	s.Connect(conn)
+
+	for _, subject := range s.subjects {
+		// component results are consumed from durable consumers if there are any
+		if s.jetstream != nil && componentResults(subject) {
+			err = s.listenDurable(conn, subject)
+		} else {
+			err = s.listen(conn, subject, s.Handle)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	if s.partitions.Count < 2 {
+		return nil
+	}
+
+	return s.listen(conn, partitionSubject(s.partitions.Index, ">"), s.handlePartition)
+}
+
+// listen : subscribes to a subject
+func (s *Subscriber) listen(conn *nats.Conn, subject string, handler nats.MsgHandler) error {
+	sub, err := s.partitions.subscribe(conn, subject, handler)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.subs = append(s.subs, sub)
+
+	return nil
+}
+
+// listenDurable : consumes the results published to a subject from a
+// durable consumer, draining it on shutdown along with other subscriptions
+func (s *Subscriber) listenDurable(conn *nats.Conn, subject string) error {
+	sub, err := s.jetstream.Subscribe(conn, subject, s.handle)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.subs = append(s.subs, sub)
+
+	return nil
+}
+
+// Handle : manages the subscription to all messages, and
 // discriminates the ones are processable.
-func subscriber(msg *nats.Msg) {
-	var scheduler Scheduler
+func (s *Subscriber) Handle(msg *nats.Msg) {
+	s.handle(msg, nil)
+}
+
+// handle : handles a message, along with the function that acknowledges
+// it once processed if it has been received from a durable consumer
+func (s *Subscriber) handle(msg *nats.Msg, ack func(bool)) {
+	settle := func(processed bool) {
+		if ack != nil {
+			ack(processed)
+		}
+	}
+
+	// messages are not handled anymore once shutting down
+	s.mu.Lock()
+	if s.closing {
+		s.mu.Unlock()
+		settle(false)
+		return
+	}
+	s.handling.Add(1)
+	s.mu.Unlock()
+	defer s.handling.Done()
+
+	// forwarded messages are only handled by the partition they were sent to
+	if strings.HasPrefix(msg.Subject, PARTITIONPREFIX) {
+		settle(true)
+		return
+	}
 
 	m, err := NewMessage(msg.Subject, msg.Data)
 	if err != nil {
+		settle(true)
 		return
 	}
 
 	if m.isSupported() != true {
+		messagesReceived.Inc(m.getType())
 		unsupported(m.subject)
+		settle(true)
+		return
+	}
+
+	if s.forward(msg, m.getServiceID()) {
+		settle(true)
+		return
+	}
+
+	messagesReceived.Inc(m.getType())
+	messageLog(m).Info("message received")
+
+	// plans and renders do not change the state of any build
+	switch m.getType() {
+	case PLANTYPE:
+		m.reply = msg.Reply
+		s.plan(m)
+		settle(true)
+		return
+	case RENDERTYPE:
+		m.reply = msg.Reply
+		s.render(m)
+		settle(true)
+		return
+	}
+
+	// messages of the same service are applied strictly in order, and
+	// durable messages are acknowledged once they have been processed
+	m.ack = ack
+	s.queue.Push(m.getServiceID(), m)
+}
+
+// begin : records a build has started
+func (s *Subscriber) begin(g *graph.Graph) {
+	s.journal.Started(g.ID)
+	s.active.Add(g.ID, g.Action)
+}
+
+// end : records a build has finished
+func (s *Subscriber) end(g *graph.Graph) {
+	s.journal.Finished(g.ID)
+	s.active.Remove(g.ID)
+}
+
+// process : processes a supported message against the latest
+// state of its service
+func (s *Subscriber) process(m *Message) {
+	var scheduler Scheduler
+	var err error
+
+	for i := 0; i <= CONFLICTRETRIES; i++ {
+		scheduler = Scheduler{slots: s.slots}
+
+		// retries are always based on the latest stored mapping
+		if i == 0 {
+			scheduler.graph, scheduler.revision = m.getGraph(s.store)
+		} else {
+			scheduler.graph, scheduler.revision = m.getGraphFromStore(s.store)
+		}
+
+		if scheduler.graph == nil {
+			s.forget(m)
+			m.acknowledge(false)
+			return
+		}
+
+		// retries may find the result already stored by the first attempt
+		if i == 0 && s.duplicate(&scheduler, m) {
+			s.redispatch(&scheduler, m)
+			return
+		}
+
+		if i == 0 && m.getType() == SERVICETYPE {
+			s.begin(scheduler.graph)
+		}
+
+		err = s.processMessage(&scheduler, m)
+		if err != ErrConflict {
+			break
+		}
+
+		messageLog(m).Warn("mapping was modified concurrently, retrying")
+	}
+
+	// durable results are delivered again until they have been processed
+	if err != nil && m.durable() {
+		s.redeliver(m, err)
+		return
+	}
+
+	m.acknowledge(true)
+
+	// released components are dispatched on behalf of the scheduler,
+	// so there is no client to reply to
+	if err != nil && m.subject == "scheduler.release" {
+		messageLog(m).Error("could not dispatch released components: " + err.Error())
+		return
+	}
+
+	if err != nil && m.getType() == CONTROLTYPE {
+		rejected(m.subject, scheduler.graph, err)
 		return
 	}
 
-	log.Printf("received: %s", msg.Subject)
+	if err != nil {
+		s.end(scheduler.graph)
+		s.tracer.Build(scheduler.graph, STATUSERRORED)
+		errored(scheduler.graph, err)
+		return
+	}
 
-	scheduler.graph = m.getGraph()
-	processMessage(&scheduler, m)
+	s.finish(&scheduler)
+}
 
+// redeliver : asks for a durable result that could not be processed to be
+// delivered again, forgetting it so it is not discarded as a duplicate
+func (s *Subscriber) redeliver(m *Message, err error) {
+	messageLog(m).Error("could not process message, waiting for it to be delivered again: " + err.Error())
+	s.forget(m)
+	m.acknowledge(false)
+}
+
+// redispatch : acknowledges a duplicated result. A durable result is delivered
+// again when its dependants could not be dispatched, so any component left
+// waiting with its dependencies satisfied is dispatched before acknowledging it
+func (s *Subscriber) redispatch(scheduler *Scheduler, m *Message) {
+	if !m.durable() {
+		m.acknowledge(true)
+		return
+	}
+
+	err := s.dispatch(scheduler, scheduler.Unblocked(), true)
+	if err != nil {
+		s.redeliver(m, err)
+		return
+	}
+
+	m.acknowledge(true)
+}
+
+// finish : notifies the result of the build if there is nothing left to do
+func (s *Subscriber) finish(scheduler *Scheduler) {
 	if scheduler.Done() {
+		s.end(scheduler.graph)
+		s.tracer.Build(scheduler.graph, STATUSCOMPLETED)
 		completed(scheduler.graph)
+		return
+	}
+
+	if scheduler.Running() || scheduler.Queued() && !scheduler.halted() {
+		return
+	}
+
+	if scheduler.Cancelled() {
+		s.end(scheduler.graph)
+		s.tracer.Build(scheduler.graph, STATUSCANCELLED)
+		cancelled(scheduler.graph)
+		return
 	}
 
-	if scheduler.Errored() && !scheduler.Running() {
-		errored(scheduler.graph, errors.New("service provisioning has failed with an error"))
+	if scheduler.Errored() {
+		s.end(scheduler.graph)
+		s.tracer.Build(scheduler.graph, STATUSERRORED)
+		errored(scheduler.graph, ErrProvisioningFailed)
 	}
 }
 
-// processMessage : get the graph and process the component
-func processMessage(scheduler *Scheduler, m *Message) {
+// processMessage : get the graph and process the component. Returns
+// ErrConflict if the mapping was modified while being processed
+func (s *Subscriber) processMessage(scheduler *Scheduler, m *Message) error {
+	if m.getType() == CONTROLTYPE {
+		return s.control(scheduler, m)
+	}
+
 	component := m.getComponent()
 
 	if m.getType() == COMPONENTYPE {
-		err := storeComponent(component)
+		s.timeouts.Stop(scheduler.graph.ID, component.GetID())
+		finished(scheduler.graph.ComponentAll(component.GetID()), component, time.Now())
+
+		if d := duration(component); d > 0 {
+			componentLatency.Observe(d.Seconds(), component.GetProvider(), component.GetType())
+		}
+
+		retried, err := s.retry(scheduler, component)
+		if err == ErrConflict || retried {
+			return err
+		}
+		// durable results are delivered again until they can be stored
+		if err != nil && m.durable() {
+			return err
+		}
 		if err != nil {
 			errored(scheduler.graph, err)
 		}
+
+		err = s.storeComponent(scheduler, component)
+		if err == ErrConflict {
+			return err
+		}
+		if err != nil && m.durable() {
+			return err
+		}
+		if err != nil {
+			errored(scheduler.graph, err)
+		}
+
+		// the slot is released once the result has been stored, so it
+		// is not released again if the result is processed again
+		s.tracer.Component(component)
+
+		s.wake(s.slots.Release(scheduler.graph.ID, component))
 	}
 
+	// a failed build is notified once processing has finished
 	componentsToSchedule, err := scheduler.Receive(component)
-	if err != nil {
+	if err != nil && err != ErrProvisioningFailed {
 		errored(scheduler.graph, err)
 	}
 
+	// skip all components that depend on a failed one
+	if component.GetState() == STATUSERRORED && scheduler.ContinueOnError() {
+		err = s.storeChanges(scheduler, scheduler.Skip(component))
+		if err == ErrConflict {
+			return err
+		}
+	}
+
+	if m.getType() == COMPONENTYPE {
+		s.journal.Transition(scheduler.graph.ID, component)
+	}
+
+	return s.dispatch(scheduler, componentsToSchedule, m.durable())
+}
+
+// dispatch : stores and sends the components that have been scheduled. Returns
+// ErrConflict if the mapping was modified while they were being stored. Components
+// scheduled by a durable result are left waiting if they can not be dispatched,
+// and the error is returned so the result is delivered again
+func (s *Subscriber) dispatch(scheduler *Scheduler, components []graph.Component, durable bool) error {
 	marshalledGraph, err := scheduler.graph.ToJSON()
 	if err != nil {
 		errored(scheduler.graph, err)
 	}
 
-	for _, c := range componentsToSchedule {
+	for _, c := range components {
 		// set the service id
 		gc := c.(*graph.GenericComponent)
 		(*gc)["service"] = scheduler.graph.ID
 
+		if c.GetState() == STATUSRUNNING {
+			setAttempts(c, getAttempts(c)+1)
+			started(c, time.Now())
+			traceComponent(c)
+		}
+
+		s.journal.Transition(scheduler.graph.ID, c)
+
 		// update component on change
-		err := setChange(c)
+		scheduler.revision, err = s.store.SetChange(c, scheduler.revision)
+		if err == ErrConflict {
+			return err
+		}
+		if err != nil && durable {
+			componentLog(c).Error("could not store change: " + err.Error())
+			s.wake(s.slots.Release(scheduler.graph.ID, c))
+			return err
+		}
 		if err != nil {
-			log.Println("could not store change: " + c.GetID())
+			componentLog(c).Error("could not store change: " + err.Error())
+			s.undispatched(scheduler, c, err)
+			continue
+		}
+
+		// queued components are sent once they get a free slot
+		if c.GetState() == STATUSQUEUED {
 			continue
 		}
 
 		// template and send component
 		c = template(marshalledGraph, c)
+		s.timeouts.Start(scheduler.graph.ID, c, time.Now())
+
 		err = send(c)
+		if err != nil && durable {
+			componentLog(c).Error("could not send component: " + err.Error())
+			s.unsent(scheduler, c)
+			return err
+		}
 		if err != nil {
-			errored(scheduler.graph, err)
+			componentLog(c).Error("could not send component: " + err.Error())
+			s.undispatched(scheduler, c, err)
+			continue
 		}
+
+		componentsSent.Inc(c.GetProvider(), c.GetType())
+		s.journal.Sent(scheduler.graph.ID, c)
 	}
+
+	return nil
+}
+
+// unsent : sets a component that could not be sent back to waiting, so it is
+// dispatched again along with the durable result that scheduled it. If it can
+// not be stored it is left running, to be failed once it times out
+func (s *Subscriber) unsent(scheduler *Scheduler, c graph.Component) {
+	var err error
+
+	c.SetState(STATUSWAITING)
+	setAttempts(c, getAttempts(c)-1)
+	scheduler.updateChange(c)
+
+	scheduler.revision, err = s.store.SetChange(c, scheduler.revision)
+	if err != nil {
+		componentLog(c).Error("could not store change: " + err.Error())
+		return
+	}
+
+	s.timeouts.Stop(scheduler.graph.ID, c.GetID())
+	s.wake(s.slots.Release(scheduler.graph.ID, c))
+	s.journal.Transition(scheduler.graph.ID, c)
+}
+
+// undispatched : fails a component that could not be dispatched,
+// freeing the slot it had taken to run
+func (s *Subscriber) undispatched(scheduler *Scheduler, c graph.Component, err error) {
+	var serr error
+
+	if c.GetState() != STATUSRUNNING {
+		return
+	}
+
+	s.timeouts.Stop(scheduler.graph.ID, c.GetID())
+	s.wake(s.slots.Release(scheduler.graph.ID, c))
+
+	c.SetState(STATUSERRORED)
+	gc := c.(*graph.GenericComponent)
+	(*gc)["error"] = err.Error()
+	scheduler.updateChange(c)
+
+	scheduler.revision, serr = s.store.SetChange(c, scheduler.revision)
+	if serr != nil {
+		componentLog(c).Error("could not store change: " + serr.Error())
+	}
+	s.journal.Transition(scheduler.graph.ID, c)
+
+	if scheduler.ContinueOnError() {
+		s.storeChanges(scheduler, scheduler.Skip(c))
+	}
+}
+
+// storeChanges : stores the state of a collection of changes
+func (s *Subscriber) storeChanges(scheduler *Scheduler, cs []graph.Component) error {
+	var err error
+
+	for _, c := range cs {
+		gc := c.(*graph.GenericComponent)
+		(*gc)["service"] = scheduler.graph.ID
+
+		scheduler.revision, err = s.store.SetChange(c, scheduler.revision)
+		if err == ErrConflict {
+			return err
+		}
+		if err != nil {
+			componentLog(c).Error("could not store change: " + err.Error())
+			continue
+		}
+
+		s.journal.Transition(scheduler.graph.ID, c)
+	}
+
+	return nil
+}
+
+// wake : processes the queued components of other services
+// once a slot has been released for them
+func (s *Subscriber) wake(services []string) {
+	for _, id := range services {
+		m, err := NewMessage("scheduler.release", []byte(`{"id":"`+id+`"}`))
+		if err != nil {
+			continue
+		}
+
+		s.queue.Push(id, m)
+	}
+}
+
+// retry : schedules a failed component to be sent again if its retry
+// policy allows it. Returns true if the component will be retried
+func (s *Subscriber) retry(scheduler *Scheduler, c graph.Component) (bool, error) {
+	if c.GetState() != STATUSERRORED || scheduler.Cancelled() {
+		return false, nil
+	}
+
+	if scheduler.Errored() && !scheduler.ContinueOnError() {
+		return false, nil
+	}
+
+	change := scheduler.graph.ComponentAll(c.GetID())
+	if change == nil {
+		return false, nil
+	}
+
+	attempts := getAttempts(change)
+	if attempts < 1 {
+		attempts = 1
+	}
+
+	retries, backoff := s.retries.For(change)
+	if attempts > retries {
+		return false, nil
+	}
+
+	marshalledGraph, err := scheduler.graph.ToJSON()
+	if err != nil {
+		return false, err
+	}
+
+	// the component is retried as it was stored, not as it was
+	// received along with the error of the connector
+	rc, err := copyComponent(change)
+	if err != nil {
+		return false, err
+	}
+
+	rc.SetState(STATUSRUNNING)
+	setAttempts(rc, attempts+1)
+	started(rc, time.Now())
+
+	scheduler.revision, err = s.store.SetChange(rc, scheduler.revision)
+	if err != nil {
+		return false, err
+	}
+
+	scheduler.updateChange(rc)
+	s.journal.Transition(scheduler.graph.ID, rc)
+
+	tc := template(marshalledGraph, rc)
+
+	wait := retryBackoff(backoff, attempts)
+	componentLog(rc).Info("retrying component, attempt " + strconv.Itoa(attempts+1) + " in " + wait.String())
+
+	id := scheduler.graph.ID
+	time.AfterFunc(wait, func() {
+		s.resend(id, tc)
+	})
+
+	return true, nil
+}
+
+// resend : sends a component that is being retried. If its build has been
+// cancelled while waiting it is failed, and if it has been paused it is
+// paused along with the rest of the build, to be sent once it is resumed
+func (s *Subscriber) resend(service string, c graph.Component) {
+	for i := 0; i <= CONFLICTRETRIES; i++ {
+		scheduler, err := s.loadBuild(service)
+		if err != nil || !scheduler.Cancelled() && !scheduler.Paused() {
+			break
+		}
+
+		if scheduler.Cancelled() {
+			notRetried(c)
+			return
+		}
+
+		err = s.suspend(scheduler, c)
+		if err == ErrConflict {
+			continue
+		}
+		if err == nil {
+			return
+		}
+
+		// a retry that can not be paused is sent anyway
+		componentLog(c).Error("could not pause component: " + err.Error())
+		break
+	}
+
+	// a component that could not be sent will error on its timeout
+	s.timeouts.Start(service, c, time.Now())
+
+	err := send(c)
+	if err != nil {
+		componentLog(c).Error("could not resend component: " + err.Error())
+		return
+	}
+
+	componentsSent.Inc(c.GetProvider(), c.GetType())
+	s.journal.Sent(service, c)
+}
+
+// suspend : pauses a component whose retry was due while its build was
+// paused, freeing its slot until the build is resumed and it is sent again
+func (s *Subscriber) suspend(scheduler *Scheduler, c graph.Component) error {
+	change := scheduler.graph.ComponentAll(c.GetID())
+	if change == nil {
+		return nil
+	}
+
+	// the attempt is counted again once it is sent
+	change.SetState(STATUSPAUSED)
+	setAttempts(change, getAttempts(change)-1)
+
+	_, err := s.store.SetChange(change, scheduler.revision)
+	if err != nil {
+		return err
+	}
+
+	componentLog(change).Info("build paused, component will be retried once resumed")
+
+	s.journal.Transition(scheduler.graph.ID, change)
+	s.wake(s.slots.Release(scheduler.graph.ID, change))
+
+	return nil
 }
 
-func storeComponent(c graph.Component) error {
+func (s *Subscriber) storeComponent(scheduler *Scheduler, c graph.Component) error {
 	var err error
 
 	// update the change
 	if c.GetAction() != "none" {
-		err = setChange(c)
+		scheduler.revision, err = s.store.SetChange(c, scheduler.revision)
 		if err != nil {
 			return err
 		}
@@ -104,14 +712,14 @@ func storeComponent(c graph.Component) error {
 	// update the component
 	switch c.GetAction() {
 	case "create", "update", "get":
-		err = setComponent(c)
+		scheduler.revision, err = s.store.SetComponent(c, scheduler.revision)
 	case "delete":
-		err = deleteComponent(c)
+		scheduler.revision, err = s.store.DeleteComponent(c, scheduler.revision)
 	case "find":
 		for _, fc := range getQueryComponents(c) {
 			gfc := fc.(*graph.GenericComponent)
 			(*gfc)["service"] = serviceID
-			err = setComponent(fc)
+			scheduler.revision, err = s.store.SetComponent(fc, scheduler.revision)
 			if err != nil {
 				return err
 			}
@@ -124,6 +732,6 @@ func storeComponent(c graph.Component) error {
 // upsupported : logs an unsupported subject
 func unsupported(subject string) {
 	if subject != "" {
-		log.Printf("Unsupported message: %s", subject)
+		logger.With(Fields{"subject": subject}).Debug("unsupported message")
 	}
 }
@@ -0,0 +1,423 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/nats-io/go-nats"
+	. "github.com/smartystreets/goconvey/convey"
+	graph "gopkg.in/r3labs/graph.v2"
+)
+
+// published : a message published by the scheduler
+type published struct {
+	subject string
+	data    map[string]interface{}
+}
+
+// capturePublished : captures all messages published by the scheduler,
+// until the returned function is called
+func capturePublished() (chan published, func()) {
+	messages := make(chan published, 100)
+	original := publish
+
+	publish = func(subject string, data []byte) error {
+		var m map[string]interface{}
+		_ = json.Unmarshal(data, &m)
+		messages <- published{subject: subject, data: m}
+		return nil
+	}
+
+	return messages, func() { publish = original }
+}
+
+// nextPublished : waits for the next message published by the scheduler
+func nextPublished(messages chan published) *published {
+	select {
+	case m := <-messages:
+		return &m
+	case <-time.After(time.Second):
+		return nil
+	}
+}
+
+// conflictingStore : a memory store whose mapping is modified
+// concurrently the first time a change is stored
+type conflictingStore struct {
+	*MemoryStore
+	modify    graph.Component
+	conflicts int
+}
+
+// SetChange : modifies the mapping before storing the first change
+func (s *conflictingStore) SetChange(c graph.Component, revision int) (int, error) {
+	if s.modify != nil {
+		_, _ = s.MemoryStore.SetChange(s.modify, 0)
+		s.modify = nil
+	}
+
+	revision, err := s.MemoryStore.SetChange(c, revision)
+	if err == ErrConflict {
+		s.conflicts++
+	}
+
+	return revision, err
+}
+
+// storedChange : gets a change from the latest stored mapping
+func storedChange(store Store, service, id string) *graph.GenericComponent {
+	mapping, err := store.GetMapping(service)
+	So(err, ShouldBeNil)
+
+	g := graph.New()
+	So(g.Load(mapping), ShouldBeNil)
+
+	return g.ComponentAll(id).(*graph.GenericComponent)
+}
+
+func TestProcess(t *testing.T) {
+	Convey("Given a build with a running component", t, func() {
+		messages, restore := capturePublished()
+		Reset(restore)
+
+		g := loadTestMapping("test")
+		for _, c := range g.Changes {
+			(*c.(*graph.GenericComponent))["service"] = g.ID
+		}
+		g.ComponentAll("instance::db-1").SetState(STATUSRUNNING)
+
+		store := &conflictingStore{MemoryStore: NewMemoryStore()}
+		_, err := store.SetMapping(g.ID, g, 0)
+		So(err, ShouldBeNil)
+
+		s := NewSubscriber(store, nil)
+		Reset(func() { s.timeouts.Stop(g.ID, "instance::db-2") })
+
+		Convey("When the mapping is modified while the component's result is processed", func() {
+			modified := cp(g.ComponentAll("network::web-new"))
+			(*modified.(*graph.GenericComponent))["modified"] = true
+			store.modify = modified
+
+			c := cp(g.ComponentAll("instance::db-1"))
+			c.SetState(STATUSCOMPLETED)
+			data, err := json.Marshal(c)
+			So(err, ShouldBeNil)
+
+			m, err := NewMessage("instance.update.aws.done", data)
+			So(err, ShouldBeNil)
+
+			s.process(m)
+
+			Convey("It should process the result again against the latest mapping", func() {
+				So(store.conflicts, ShouldEqual, 1)
+				So(storedChange(store, g.ID, "instance::db-1").GetState(), ShouldEqual, STATUSCOMPLETED)
+				So((*storedChange(store, g.ID, "network::web-new"))["modified"], ShouldEqual, true)
+			})
+
+			Convey("It should send its dependants once", func() {
+				So(storedChange(store, g.ID, "instance::db-2").GetState(), ShouldEqual, STATUSRUNNING)
+
+				sent := nextPublished(messages)
+				So(sent, ShouldNotBeNil)
+				So(sent.data["_component_id"], ShouldEqual, "instance::db-2")
+				So(len(messages), ShouldEqual, 0)
+			})
+		})
+	})
+}
+
+// contendedStore : a memory store whose mapping is always
+// modified concurrently while a change is stored
+type contendedStore struct {
+	*MemoryStore
+}
+
+// SetChange : fails to store the change with a conflict
+func (s *contendedStore) SetChange(c graph.Component, revision int) (int, error) {
+	return revision, ErrConflict
+}
+
+func TestRelease(t *testing.T) {
+	Convey("Given a build with a queued component", t, func() {
+		messages, restore := capturePublished()
+		Reset(restore)
+
+		g := loadTestMapping("test")
+		for _, c := range g.Changes {
+			(*c.(*graph.GenericComponent))["service"] = g.ID
+		}
+		g.ComponentAll("network::web-new").SetState(STATUSQUEUED)
+
+		store := &contendedStore{NewMemoryStore()}
+		_, err := store.SetMapping(g.ID, g, 0)
+		So(err, ShouldBeNil)
+
+		s := NewSubscriber(store, nil)
+
+		Convey("When the component can not be dispatched once a slot is released", func() {
+			m, err := NewMessage("scheduler.release", []byte(`{"id":"`+g.ID+`"}`))
+			So(err, ShouldBeNil)
+
+			s.process(m)
+
+			Convey("It should not publish an error for the internal release message", func() {
+				So(len(messages), ShouldEqual, 0)
+			})
+		})
+	})
+}
+
+// unavailableStore : a memory store that fails to store any change
+type unavailableStore struct {
+	*MemoryStore
+}
+
+// SetChange : fails to store the change
+func (s *unavailableStore) SetChange(c graph.Component, revision int) (int, error) {
+	return revision, errors.New("store unavailable")
+}
+
+func TestDurableResults(t *testing.T) {
+	Convey("Given a build with a running component", t, func() {
+		messages, restore := capturePublished()
+		Reset(restore)
+
+		g := loadTestMapping("test")
+		for _, c := range g.Changes {
+			(*c.(*graph.GenericComponent))["service"] = g.ID
+		}
+		g.ComponentAll("instance::db-1").SetState(STATUSRUNNING)
+
+		memory := NewMemoryStore()
+		_, err := memory.SetMapping(g.ID, g, 0)
+		So(err, ShouldBeNil)
+
+		c := cp(g.ComponentAll("instance::db-1"))
+		c.SetState(STATUSCOMPLETED)
+		data, err := json.Marshal(c)
+		So(err, ShouldBeNil)
+
+		var acks []bool
+		ack := func(processed bool) {
+			acks = append(acks, processed)
+		}
+
+		Convey("When its result is received from a durable consumer", func() {
+			s := NewSubscriber(memory, nil)
+			Reset(func() { s.timeouts.Stop(g.ID, "instance::db-2") })
+
+			s.handle(&nats.Msg{Subject: "instance.update.aws.done", Data: data}, ack)
+			So(s.queue.Wait(time.Second), ShouldBeTrue)
+
+			Convey("It should acknowledge it once stored and its dependants dispatched", func() {
+				So(acks, ShouldResemble, []bool{true})
+				So(storedChange(memory, g.ID, "instance::db-1").GetState(), ShouldEqual, STATUSCOMPLETED)
+				So(storedChange(memory, g.ID, "instance::db-2").GetState(), ShouldEqual, STATUSRUNNING)
+				So(len(messages), ShouldEqual, 1)
+			})
+		})
+
+		Convey("When its result can not be stored", func() {
+			s := NewSubscriber(&unavailableStore{memory}, nil)
+
+			s.handle(&nats.Msg{Subject: "instance.update.aws.done", Data: data}, ack)
+			So(s.queue.Wait(time.Second), ShouldBeTrue)
+
+			Convey("It should ask for it to be delivered again, without failing the build", func() {
+				So(acks, ShouldResemble, []bool{false})
+				So(storedChange(memory, g.ID, "instance::db-1").GetState(), ShouldEqual, STATUSRUNNING)
+				So(len(messages), ShouldEqual, 0)
+			})
+		})
+
+		Convey("When its dependants can not be sent", func() {
+			s := NewSubscriber(memory, nil)
+			Reset(func() {
+				for _, c := range g.Changes {
+					s.timeouts.Stop(g.ID, c.GetID())
+				}
+			})
+
+			capture := publish
+			publish = func(subject string, data []byte) error {
+				return errors.New("nats: connection closed")
+			}
+
+			s.handle(&nats.Msg{Subject: "instance.update.aws.done", Data: data}, ack)
+			So(s.queue.Wait(time.Second), ShouldBeTrue)
+
+			publish = capture
+
+			Convey("It should ask for it to be delivered again, leaving its dependants waiting", func() {
+				So(acks, ShouldResemble, []bool{false})
+				So(storedChange(memory, g.ID, "instance::db-1").GetState(), ShouldEqual, STATUSCOMPLETED)
+				So(storedChange(memory, g.ID, "instance::db-2").GetState(), ShouldEqual, STATUSWAITING)
+				So(len(messages), ShouldEqual, 0)
+			})
+
+			Convey("It should send its dependants once it is delivered again", func() {
+				s.handle(&nats.Msg{Subject: "instance.update.aws.done", Data: data}, ack)
+				So(s.queue.Wait(time.Second), ShouldBeTrue)
+
+				So(acks, ShouldResemble, []bool{false, true})
+				So(storedChange(memory, g.ID, "instance::db-2").GetState(), ShouldEqual, STATUSRUNNING)
+
+				var sent []interface{}
+				for len(messages) > 0 {
+					sent = append(sent, nextPublished(messages).data["_component_id"])
+				}
+				So(sent, ShouldContain, "instance::db-2")
+			})
+		})
+	})
+}
+
+func TestRetry(t *testing.T) {
+	Convey("Given a build with a running component that can be retried", t, func() {
+		messages, restore := capturePublished()
+		Reset(restore)
+
+		store := NewMemoryStore()
+		s := NewSubscriber(store, nil)
+		s.retries = &RetryPolicy{Retry: Retry{Retries: 1, Backoff: "1ms"}}
+
+		g := loadTestMapping("test")
+		change := g.ComponentAll("instance::db-1")
+		(*change.(*graph.GenericComponent))["service"] = g.ID
+		change.SetState(STATUSRUNNING)
+		_, err := store.SetMapping(g.ID, g, 0)
+		So(err, ShouldBeNil)
+
+		scheduler, err := s.loadBuild(g.ID)
+		So(err, ShouldBeNil)
+
+		Convey("When the connector replies with an error", func() {
+			c := cp(change)
+			c.SetState(STATUSERRORED)
+			(*c.(*graph.GenericComponent))["error"] = "connector failed"
+			(*c.(*graph.GenericComponent))["_message_id"] = "message-1"
+
+			retried, err := s.retry(scheduler, c)
+			Reset(func() { s.timeouts.Stop(g.ID, c.GetID()) })
+
+			resent := nextPublished(messages)
+
+			Convey("It should retry the stored change", func() {
+				So(err, ShouldBeNil)
+				So(retried, ShouldBeTrue)
+
+				mapping, err := store.GetMapping(g.ID)
+				So(err, ShouldBeNil)
+				sg := graph.New()
+				So(sg.Load(mapping), ShouldBeNil)
+
+				stored := sg.ComponentAll("instance::db-1").(*graph.GenericComponent)
+				So(stored.GetState(), ShouldEqual, STATUSRUNNING)
+				So(getAttempts(stored), ShouldEqual, 2)
+				So((*stored)["error"], ShouldBeNil)
+				So((*stored)["_message_id"], ShouldBeNil)
+			})
+
+			Convey("It should resend the component without the error of the connector", func() {
+				m := resent
+				So(m, ShouldNotBeNil)
+				So(m.subject, ShouldEqual, componentSubject(change))
+				So(m.data["_state"], ShouldEqual, STATUSRUNNING)
+				So(m.data["error"], ShouldBeNil)
+				So(m.data["_message_id"], ShouldBeNil)
+			})
+		})
+
+		Convey("When the build is cancelled while the component waits to be retried", func() {
+			s.retries = &RetryPolicy{Retry: Retry{Retries: 1, Backoff: "50ms"}}
+
+			c := cp(change)
+			c.SetState(STATUSERRORED)
+
+			retried, err := s.retry(scheduler, c)
+			So(err, ShouldBeNil)
+			So(retried, ShouldBeTrue)
+
+			_, err = store.SetChange(serviceComponent("instance::web-1", g.ID, STATUSCANCELLED), 0)
+			So(err, ShouldBeNil)
+
+			failed := nextPublished(messages)
+
+			Convey("It should not resend the component, and fail it instead", func() {
+				m := failed
+				So(m, ShouldNotBeNil)
+				So(m.subject, ShouldEqual, componentSubject(change)+".error")
+				So(m.data["_state"], ShouldEqual, STATUSERRORED)
+			})
+
+			Convey("It should not retry it once it has failed", func() {
+				scheduler, err := s.loadBuild(g.ID)
+				So(err, ShouldBeNil)
+
+				retried, err := s.retry(scheduler, c)
+				So(err, ShouldBeNil)
+				So(retried, ShouldBeFalse)
+			})
+		})
+
+		Convey("When the build is paused while the component waits to be retried", func() {
+			s.retries = &RetryPolicy{Retry: Retry{Retries: 1, Backoff: "200ms"}}
+			Reset(func() {
+				for _, c := range g.Changes {
+					s.timeouts.Stop(g.ID, c.GetID())
+				}
+			})
+
+			c := cp(change)
+			c.SetState(STATUSERRORED)
+
+			retried, err := s.retry(scheduler, c)
+			So(err, ShouldBeNil)
+			So(retried, ShouldBeTrue)
+
+			pause, err := NewMessage("build.pause", []byte(`{"id":"`+g.ID+`"}`))
+			So(err, ShouldBeNil)
+			s.process(pause)
+
+			acknowledged := nextPublished(messages)
+			So(acknowledged, ShouldNotBeNil)
+			So(acknowledged.subject, ShouldEqual, "build.pause.done")
+
+			// wait for the retry to be due
+			deadline := time.Now().Add(time.Second)
+			for storedChange(store, g.ID, "instance::db-1").GetState() != STATUSPAUSED && time.Now().Before(deadline) {
+				time.Sleep(10 * time.Millisecond)
+			}
+
+			Convey("It should keep the retry pending, without failing it", func() {
+				So(len(messages), ShouldEqual, 0)
+
+				stored := storedChange(store, g.ID, "instance::db-1")
+				So(stored.GetState(), ShouldEqual, STATUSPAUSED)
+				So(getAttempts(stored), ShouldEqual, 1)
+			})
+
+			Convey("It should resend the component once the build is resumed", func() {
+				resume, err := NewMessage("build.resume", []byte(`{"id":"`+g.ID+`"}`))
+				So(err, ShouldBeNil)
+				s.process(resume)
+
+				var sent []interface{}
+				for len(messages) > 0 {
+					sent = append(sent, nextPublished(messages).data["_component_id"])
+				}
+				So(sent, ShouldContain, "instance::db-1")
+
+				stored := storedChange(store, g.ID, "instance::db-1")
+				So(stored.GetState(), ShouldEqual, STATUSRUNNING)
+				So(getAttempts(stored), ShouldEqual, 2)
+			})
+		})
+	})
+}
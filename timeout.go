@@ -0,0 +1,115 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package main
+
+import (
+	"os"
+	"sync"
+	"time"
+
+	graph "gopkg.in/r3labs/graph.v2"
+)
+
+// DEFAULTTIMEOUT : time a component has to reply, unless
+// configured otherwise
+const DEFAULTTIMEOUT = time.Hour
+
+// Timeouts : tracks the deadline of every component that has been sent,
+// and notifies the components that have not replied before it
+type Timeouts struct {
+	mu      sync.Mutex
+	timeout time.Duration
+	timers  map[string]*time.Timer
+	expired func(graph.Component, time.Duration)
+}
+
+// NewTimeouts : Timeouts constructor. A default timeout of zero
+// only applies timeouts to components that define their own
+func NewTimeouts(timeout time.Duration, expired func(graph.Component, time.Duration)) *Timeouts {
+	return &Timeouts{
+		timeout: timeout,
+		timers:  make(map[string]*time.Timer),
+		expired: expired,
+	}
+}
+
+// Start : starts the deadline of a component sent at the given time
+func (t *Timeouts) Start(service string, c graph.Component, sent time.Time) {
+	timeout := componentTimeout(c, t.timeout)
+	if timeout <= 0 {
+		return
+	}
+
+	cc, err := copyComponent(c)
+	if err != nil {
+		componentLog(c).Error("could not start timeout: " + err.Error())
+		return
+	}
+
+	key := service + "/" + c.GetID()
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if timer, ok := t.timers[key]; ok {
+		timer.Stop()
+	}
+
+	var timer *time.Timer
+	timer = time.AfterFunc(time.Until(sent.Add(timeout)), func() {
+		t.mu.Lock()
+		if t.timers[key] != timer {
+			t.mu.Unlock()
+			return
+		}
+		delete(t.timers, key)
+		t.mu.Unlock()
+
+		t.expired(cc, timeout)
+	})
+
+	t.timers[key] = timer
+}
+
+// Stop : stops the deadline of a component that has replied
+func (t *Timeouts) Stop(service, id string) {
+	key := service + "/" + id
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if timer, ok := t.timers[key]; ok {
+		timer.Stop()
+		delete(t.timers, key)
+	}
+}
+
+// defaultTimeout : gets the default component timeout from the environment
+func defaultTimeout() time.Duration {
+	timeout, err := time.ParseDuration(os.Getenv("SCHEDULER_COMPONENT_TIMEOUT"))
+	if err != nil {
+		return DEFAULTTIMEOUT
+	}
+
+	return timeout
+}
+
+// componentTimeout : gets the timeout of a component, defined by its '_timeout'
+// field either as a duration ("10m") or as a number of seconds
+func componentTimeout(c graph.Component, timeout time.Duration) time.Duration {
+	gc := c.(*graph.GenericComponent)
+
+	switch v := (*gc)["_timeout"].(type) {
+	case float64:
+		return time.Duration(v * float64(time.Second))
+	case string:
+		d, err := time.ParseDuration(v)
+		if err == nil {
+			return d
+		}
+	}
+
+	return timeout
+}
@@ -0,0 +1,76 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package main
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+	graph "gopkg.in/r3labs/graph.v2"
+)
+
+func TestTimeouts(t *testing.T) {
+	Convey("Given a component", t, func() {
+		c := serviceComponent("network::web-new", "service-1", STATUSRUNNING)
+		gc := c.(*graph.GenericComponent)
+
+		Convey("When it has no timeout defined", func() {
+			Convey("It should use the default timeout", func() {
+				So(componentTimeout(c, time.Minute), ShouldEqual, time.Minute)
+			})
+		})
+
+		Convey("When it defines its timeout as a duration", func() {
+			(*gc)["_timeout"] = "10m"
+			Convey("It should use its own timeout", func() {
+				So(componentTimeout(c, time.Minute), ShouldEqual, time.Minute*10)
+			})
+		})
+
+		Convey("When it defines its timeout in seconds", func() {
+			(*gc)["_timeout"] = float64(30)
+			Convey("It should use its own timeout", func() {
+				So(componentTimeout(c, time.Minute), ShouldEqual, time.Second*30)
+			})
+		})
+	})
+
+	Convey("Given a set of timeouts", t, func() {
+		expired := make(chan graph.Component, 1)
+
+		ts := NewTimeouts(time.Millisecond*10, func(c graph.Component, timeout time.Duration) {
+			expired <- c
+		})
+
+		c := serviceComponent("network::web-new", "service-1", STATUSRUNNING)
+
+		Convey("When a component does not reply before its deadline", func() {
+			ts.Start("service-1", c, time.Now())
+
+			Convey("It should be notified as expired", func() {
+				select {
+				case ec := <-expired:
+					So(ec.GetID(), ShouldEqual, "network::web-new")
+				case <-time.After(time.Second):
+					So("timeout", ShouldBeNil)
+				}
+			})
+		})
+
+		Convey("When a component replies before its deadline", func() {
+			ts.Start("service-1", c, time.Now())
+			ts.Stop("service-1", c.GetID())
+
+			Convey("It should not be notified as expired", func() {
+				select {
+				case <-expired:
+					So("expired", ShouldBeNil)
+				case <-time.After(time.Millisecond * 50):
+				}
+			})
+		})
+	})
+}
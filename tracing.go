@@ -0,0 +1,333 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	graph "gopkg.in/r3labs/graph.v2"
+)
+
+// SpanContext : identifies a span within a trace
+type SpanContext struct {
+	TraceID string
+	SpanID  string
+}
+
+// NewSpanContext : returns a context for a new span on the given trace,
+// or on a new trace if none is given
+func NewSpanContext(traceID string) SpanContext {
+	if traceID == "" {
+		traceID = newID(16)
+	}
+
+	return SpanContext{TraceID: traceID, SpanID: newID(8)}
+}
+
+// String : formats the context as a w3c traceparent
+func (sc SpanContext) String() string {
+	return "00-" + sc.TraceID + "-" + sc.SpanID + "-01"
+}
+
+// parseSpanContext : parses a w3c traceparent
+func parseSpanContext(v interface{}) (SpanContext, bool) {
+	s, _ := v.(string)
+
+	parts := strings.Split(s, "-")
+	if len(parts) != 4 || len(parts[1]) != 32 || len(parts[2]) != 16 {
+		return SpanContext{}, false
+	}
+
+	return SpanContext{TraceID: parts[1], SpanID: parts[2]}, true
+}
+
+// newID : random hex id of n bytes
+func newID(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+
+	return hex.EncodeToString(b)
+}
+
+// Span : a timed operation of a build
+type Span struct {
+	TraceID    string                 `json:"trace_id"`
+	SpanID     string                 `json:"span_id"`
+	ParentID   string                 `json:"parent_id,omitempty"`
+	Name       string                 `json:"name"`
+	Start      time.Time              `json:"start"`
+	End        time.Time              `json:"end"`
+	Status     string                 `json:"status"`
+	Attributes map[string]interface{} `json:"attributes,omitempty"`
+}
+
+// trace : starts the trace of a build. The context of the build's span
+// is kept on every change as '_trace', as they are stored along with them
+func trace(g *graph.Graph) {
+	sc := NewSpanContext("")
+
+	for _, c := range g.Changes {
+		gc := c.(*graph.GenericComponent)
+		(*gc)["_trace"] = sc.String()
+	}
+}
+
+// traceComponent : starts the span of a component that is about to be sent,
+// as a child of its build's span. Its context is sent to the component
+// as '_traceparent', so it can be joined by the connectors. Retried
+// components keep the span they were first sent with
+func traceComponent(c graph.Component) {
+	gc := c.(*graph.GenericComponent)
+
+	if _, ok := parseSpanContext((*gc)["_traceparent"]); ok {
+		return
+	}
+
+	build, ok := parseSpanContext((*gc)["_trace"])
+	if !ok {
+		return
+	}
+
+	(*gc)["_traceparent"] = NewSpanContext(build.TraceID).String()
+}
+
+// spanContext : context of the innermost span a component belongs to
+func spanContext(c graph.Component) (SpanContext, bool) {
+	gc, ok := c.(*graph.GenericComponent)
+	if !ok {
+		return SpanContext{}, false
+	}
+
+	if sc, ok := parseSpanContext((*gc)["_traceparent"]); ok {
+		return sc, true
+	}
+
+	return parseSpanContext((*gc)["_trace"])
+}
+
+// Tracer : exports the spans of all builds to a file, one json object per line
+type Tracer struct {
+	mu   sync.Mutex
+	file *os.File
+}
+
+// NewTracer : Tracer constructor
+func NewTracer(path string) (*Tracer, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Tracer{file: f}, nil
+}
+
+// tracer : gets the file spans are exported to from the environment.
+// By default spans are not exported
+func tracer() *Tracer {
+	path := os.Getenv("SCHEDULER_TRACE_FILE")
+	if path == "" {
+		return nil
+	}
+
+	t, err := NewTracer(path)
+	if err != nil {
+		logger.Error("could not open trace file: " + err.Error())
+		return nil
+	}
+
+	return t
+}
+
+// Export : writes a span. A nil Tracer does not export any span
+func (t *Tracer) Export(s Span) {
+	if t == nil {
+		return
+	}
+
+	data, err := json.Marshal(s)
+	if err != nil {
+		logger.Error("could not export span: " + err.Error())
+		return
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	_, err = t.file.Write(append(data, '\n'))
+	if err != nil {
+		logger.Error("could not export span: " + err.Error())
+	}
+}
+
+// Component : exports the span of a component that has finished,
+// from the time it was first sent until it replied
+func (t *Tracer) Component(c graph.Component) {
+	gc, ok := c.(*graph.GenericComponent)
+	if t == nil || !ok {
+		return
+	}
+
+	sc, ok := parseSpanContext((*gc)["_traceparent"])
+	if !ok {
+		return
+	}
+
+	build, _ := parseSpanContext((*gc)["_trace"])
+	start, _ := getTime(c, "_started_at")
+	end, _ := getTime(c, "_finished_at")
+
+	t.Export(Span{
+		TraceID:  sc.TraceID,
+		SpanID:   sc.SpanID,
+		ParentID: build.SpanID,
+		Name:     componentSubject(c),
+		Start:    start,
+		End:      end,
+		Status:   c.GetState(),
+		Attributes: map[string]interface{}{
+			"component_id": c.GetID(),
+			"action":       c.GetAction(),
+			"provider":     c.GetProvider(),
+			"attempts":     getAttempts(c),
+		},
+	})
+}
+
+// Build : exports the span of a build that has finished
+func (t *Tracer) Build(g *graph.Graph, status string) {
+	if t == nil || len(g.Changes) < 1 {
+		return
+	}
+
+	gc := g.Changes[0].(*graph.GenericComponent)
+
+	sc, ok := parseSpanContext((*gc)["_trace"])
+	if !ok {
+		return
+	}
+
+	end := time.Now().UTC()
+	start := end
+
+	summary := Scheduler{graph: g}.Summary()
+	if first, err := time.Parse(time.RFC3339Nano, summary.StartedAt); err == nil {
+		start = first
+	}
+
+	t.Export(Span{
+		TraceID:    sc.TraceID,
+		SpanID:     sc.SpanID,
+		Name:       g.Action,
+		Start:      start,
+		End:        end,
+		Status:     status,
+		Attributes: map[string]interface{}{"service_id": g.ID},
+	})
+}
+
+// TracedStore : exports a span for every request to a store, as
+// a child of the component or build it belongs to
+type TracedStore struct {
+	Store
+	tracer *Tracer
+}
+
+// NewTracedStore : TracedStore constructor
+func NewTracedStore(store Store, tracer *Tracer) *TracedStore {
+	return &TracedStore{Store: store, tracer: tracer}
+}
+
+// GetMapping : gets the latest mapping of a service
+func (s *TracedStore) GetMapping(id string) (map[string]interface{}, error) {
+	start := time.Now().UTC()
+	mapping, err := s.Store.GetMapping(id)
+
+	// the trace of the build is only known once its mapping has been retrieved
+	if changes, ok := mapping["changes"].([]interface{}); ok && len(changes) > 0 {
+		if c, ok := changes[0].(map[string]interface{}); ok {
+			s.span("store.get_mapping", graph.MapGenericComponent(c), start, err)
+		}
+	}
+
+	return mapping, err
+}
+
+// SetMapping : stores the mapping of a service
+func (s *TracedStore) SetMapping(id string, mapping *graph.Graph, revision int) (int, error) {
+	start := time.Now().UTC()
+	revision, err := s.Store.SetMapping(id, mapping, revision)
+
+	if len(mapping.Changes) > 0 {
+		s.span("store.set_mapping", mapping.Changes[0], start, err)
+	}
+
+	return revision, err
+}
+
+// SetComponent : stores a component on the mapping's components
+func (s *TracedStore) SetComponent(c graph.Component, revision int) (int, error) {
+	start := time.Now().UTC()
+	revision, err := s.Store.SetComponent(c, revision)
+	s.span("store.set_component", c, start, err)
+
+	return revision, err
+}
+
+// DeleteComponent : removes a component from the mapping's components
+func (s *TracedStore) DeleteComponent(c graph.Component, revision int) (int, error) {
+	start := time.Now().UTC()
+	revision, err := s.Store.DeleteComponent(c, revision)
+	s.span("store.delete_component", c, start, err)
+
+	return revision, err
+}
+
+// SetChange : stores a component on the mapping's changes
+func (s *TracedStore) SetChange(c graph.Component, revision int) (int, error) {
+	start := time.Now().UTC()
+	revision, err := s.Store.SetChange(c, revision)
+	s.span("store.set_change", c, start, err)
+
+	return revision, err
+}
+
+// DeleteChange : removes a component from the mapping's changes
+func (s *TracedStore) DeleteChange(c graph.Component, revision int) (int, error) {
+	start := time.Now().UTC()
+	revision, err := s.Store.DeleteChange(c, revision)
+	s.span("store.delete_change", c, start, err)
+
+	return revision, err
+}
+
+// span : exports the span of a request to the store
+func (s *TracedStore) span(name string, c graph.Component, start time.Time, err error) {
+	parent, ok := spanContext(c)
+	if !ok {
+		return
+	}
+
+	status := "ok"
+	if err != nil {
+		status = err.Error()
+	}
+
+	s.tracer.Export(Span{
+		TraceID:    parent.TraceID,
+		SpanID:     newID(8),
+		ParentID:   parent.SpanID,
+		Name:       name,
+		Start:      start,
+		End:        time.Now().UTC(),
+		Status:     status,
+		Attributes: map[string]interface{}{"component_id": c.GetID()},
+	})
+}
@@ -0,0 +1,117 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+	graph "gopkg.in/r3labs/graph.v2"
+)
+
+func readSpans(path string) []Span {
+	var spans []Span
+
+	f, err := os.Open(path)
+	if err != nil {
+		return spans
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var s Span
+		if json.Unmarshal(scanner.Bytes(), &s) == nil {
+			spans = append(spans, s)
+		}
+	}
+
+	return spans
+}
+
+func TestTracing(t *testing.T) {
+	Convey("Given a build that has been traced", t, func() {
+		dir, err := ioutil.TempDir("", "scheduler")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+
+		path := filepath.Join(dir, "spans.json")
+		tracer, err := NewTracer(path)
+		So(err, ShouldBeNil)
+
+		g := loadTestMapping("test")
+		trace(g)
+
+		build, ok := parseSpanContext((*g.Changes[0].(*graph.GenericComponent))["_trace"])
+		So(ok, ShouldBeTrue)
+
+		Convey("When a component is sent", func() {
+			c := g.Changes[0]
+			traceComponent(c)
+
+			sc, ok := parseSpanContext((*c.(*graph.GenericComponent))["_traceparent"])
+
+			Convey("It should start a span on the trace of the build", func() {
+				So(ok, ShouldBeTrue)
+				So(sc.TraceID, ShouldEqual, build.TraceID)
+				So(sc.SpanID, ShouldNotEqual, build.SpanID)
+			})
+
+			Convey("It should keep its span when it is sent again", func() {
+				traceComponent(c)
+				again, _ := parseSpanContext((*c.(*graph.GenericComponent))["_traceparent"])
+				So(again, ShouldResemble, sc)
+			})
+
+			Convey("It should export its span once it has finished", func() {
+				now := time.Now()
+				started(c, now)
+				c.SetState(STATUSCOMPLETED)
+				finished(nil, c, now.Add(time.Second))
+				tracer.Component(c)
+
+				spans := readSpans(path)
+				So(spans, ShouldHaveLength, 1)
+				So(spans[0].SpanID, ShouldEqual, sc.SpanID)
+				So(spans[0].ParentID, ShouldEqual, build.SpanID)
+				So(spans[0].Status, ShouldEqual, STATUSCOMPLETED)
+				So(spans[0].End.Sub(spans[0].Start), ShouldEqual, time.Second)
+			})
+
+			Convey("It should export the requests to the store as its children", func() {
+				(*c.(*graph.GenericComponent))["service"] = g.ID
+				store := NewTracedStore(NewMemoryStore(), tracer)
+				_, err := store.SetMapping(g.ID, g, 0)
+				So(err, ShouldBeNil)
+				_, err = store.SetChange(c, 1)
+				So(err, ShouldBeNil)
+
+				spans := readSpans(path)
+				So(spans, ShouldHaveLength, 2)
+				So(spans[0].Name, ShouldEqual, "store.set_mapping")
+				So(spans[1].Name, ShouldEqual, "store.set_change")
+				So(spans[1].TraceID, ShouldEqual, build.TraceID)
+				So(spans[1].ParentID, ShouldEqual, sc.SpanID)
+			})
+		})
+
+		Convey("When the build finishes", func() {
+			tracer.Build(g, STATUSCOMPLETED)
+
+			Convey("It should export the span of the build", func() {
+				spans := readSpans(path)
+				So(spans, ShouldHaveLength, 1)
+				So(spans[0].SpanID, ShouldEqual, build.SpanID)
+				So(spans[0].ParentID, ShouldEqual, "")
+			})
+		})
+	})
+}
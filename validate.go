@@ -0,0 +1,190 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package main
+
+import (
+	graph "gopkg.in/r3labs/graph.v2"
+)
+
+// Problem : an issue found when validating a graph
+type Problem struct {
+	Type      string `json:"type"`
+	Component string `json:"component,omitempty"`
+	Message   string `json:"message"`
+}
+
+// validActions : actions a change can define
+var validActions = map[string]bool{
+	"create": true,
+	"update": true,
+	"delete": true,
+	"get":    true,
+	"find":   true,
+	"none":   true,
+}
+
+// validate : returns all problems that would prevent a graph from being built
+func validate(g *graph.Graph) []Problem {
+	var problems []Problem
+
+	problems = append(problems, validateComponents(g)...)
+	problems = append(problems, validateEdges(g)...)
+	problems = append(problems, validateCycles(g)...)
+	problems = append(problems, validatePaths(g)...)
+
+	return problems
+}
+
+// validateComponents : checks for duplicated ids and unknown actions
+func validateComponents(g *graph.Graph) []Problem {
+	var problems []Problem
+
+	for _, set := range [][]graph.Component{g.Changes, g.Components} {
+		ids := make(map[string]bool)
+
+		for _, c := range set {
+			if ids[c.GetID()] {
+				problems = append(problems, Problem{
+					Type:      "duplicate",
+					Component: c.GetID(),
+					Message:   "component id is not unique",
+				})
+			}
+			ids[c.GetID()] = true
+		}
+	}
+
+	for _, c := range g.Changes {
+		if !validActions[c.GetAction()] {
+			problems = append(problems, Problem{
+				Type:      "action",
+				Component: c.GetID(),
+				Message:   "unknown action '" + c.GetAction() + "'",
+			})
+		}
+	}
+
+	return problems
+}
+
+// validateEdges : checks all edges connect existing components
+func validateEdges(g *graph.Graph) []Problem {
+	var problems []Problem
+
+	reported := make(map[string]bool)
+
+	for _, edge := range g.Edges {
+		for _, id := range []string{edge.Source, edge.Destination} {
+			if id == "start" || id == "end" || reported[id] || g.ComponentAll(id) != nil {
+				continue
+			}
+
+			reported[id] = true
+			problems = append(problems, Problem{
+				Type:      "edge",
+				Component: id,
+				Message:   "edge references a component that does not exist",
+			})
+		}
+	}
+
+	return problems
+}
+
+// validateCycles : checks the graph has no cycles
+func validateCycles(g *graph.Graph) []Problem {
+	var problems []Problem
+
+	// components are unvisited (0), being visited (1) or visited (2)
+	visits := make(map[string]int)
+
+	var visit func(id string)
+	visit = func(id string) {
+		visits[id] = 1
+
+		for _, edge := range g.Edges {
+			if edge.Source != id {
+				continue
+			}
+
+			switch visits[edge.Destination] {
+			case 0:
+				visit(edge.Destination)
+			case 1:
+				problems = append(problems, Problem{
+					Type:      "cycle",
+					Component: edge.Destination,
+					Message:   "component depends on itself through '" + id + "'",
+				})
+			}
+		}
+
+		visits[id] = 2
+	}
+
+	for _, edge := range g.Edges {
+		if visits[edge.Source] == 0 {
+			visit(edge.Source)
+		}
+	}
+
+	return problems
+}
+
+// validatePaths : checks all changes can be reached from the
+// start of the graph, and can reach the end of it
+func validatePaths(g *graph.Graph) []Problem {
+	var problems []Problem
+
+	fromStart := reachable(g, "start", func(e graph.Edge) (string, string) {
+		return e.Source, e.Destination
+	})
+
+	toEnd := reachable(g, "end", func(e graph.Edge) (string, string) {
+		return e.Destination, e.Source
+	})
+
+	for _, c := range g.Changes {
+		if !fromStart[c.GetID()] {
+			problems = append(problems, Problem{
+				Type:      "path",
+				Component: c.GetID(),
+				Message:   "component can not be reached from start",
+			})
+		}
+
+		if !toEnd[c.GetID()] {
+			problems = append(problems, Problem{
+				Type:      "path",
+				Component: c.GetID(),
+				Message:   "component has no path to end",
+			})
+		}
+	}
+
+	return problems
+}
+
+// reachable : returns all components reachable from a component, following
+// edges in the direction given by the direction function
+func reachable(g *graph.Graph, id string, direction func(graph.Edge) (string, string)) map[string]bool {
+	visited := map[string]bool{id: true}
+	pending := []string{id}
+
+	for len(pending) > 0 {
+		current := pending[0]
+		pending = pending[1:]
+
+		for _, edge := range g.Edges {
+			from, to := direction(edge)
+			if from == current && !visited[to] {
+				visited[to] = true
+				pending = append(pending, to)
+			}
+		}
+	}
+
+	return visited
+}
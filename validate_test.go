@@ -0,0 +1,86 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package main
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+	graph "gopkg.in/r3labs/graph.v2"
+)
+
+func TestValidate(t *testing.T) {
+	Convey("Given a valid graph", t, func() {
+		g := loadTestMapping("test")
+
+		Convey("When validating it", func() {
+			Convey("It should not return any problems", func() {
+				So(validate(g), ShouldBeEmpty)
+			})
+		})
+
+		Convey("When a change has an unknown action", func() {
+			(*g.Changes[0].(*graph.GenericComponent))["_action"] = "destroy"
+
+			Convey("It should report the action", func() {
+				problems := validate(g)
+				So(problems, ShouldHaveLength, 1)
+				So(problems[0].Type, ShouldEqual, "action")
+				So(problems[0].Component, ShouldEqual, g.Changes[0].GetID())
+			})
+		})
+
+		Convey("When a change id is duplicated", func() {
+			g.Changes = append(g.Changes, g.Changes[0])
+
+			Convey("It should report the duplicated id", func() {
+				problems := validate(g)
+				So(problems, ShouldHaveLength, 1)
+				So(problems[0].Type, ShouldEqual, "duplicate")
+				So(problems[0].Component, ShouldEqual, g.Changes[0].GetID())
+			})
+		})
+
+		Convey("When an edge references a missing component", func() {
+			g.Edges = append(g.Edges, graph.Edge{Source: "instance::db-1", Destination: "instance::missing"})
+
+			Convey("It should report the missing component", func() {
+				problems := validate(g)
+				So(problems, ShouldHaveLength, 1)
+				So(problems[0].Type, ShouldEqual, "edge")
+				So(problems[0].Component, ShouldEqual, "instance::missing")
+			})
+		})
+
+		Convey("When the graph contains a cycle", func() {
+			g.Edges = append(g.Edges, graph.Edge{Source: "instance::db-2", Destination: "instance::db-1"})
+
+			Convey("It should report the cycle", func() {
+				problems := validate(g)
+				So(problems, ShouldHaveLength, 1)
+				So(problems[0].Type, ShouldEqual, "cycle")
+			})
+		})
+
+		Convey("When a change is not connected to start or end", func() {
+			var edges []graph.Edge
+			for _, e := range g.Edges {
+				if e.Source != "instance::db-2" && e.Destination != "instance::db-2" {
+					edges = append(edges, e)
+				}
+			}
+			g.Edges = edges
+
+			Convey("It should report the missing paths", func() {
+				problems := validate(g)
+				So(problems, ShouldHaveLength, 3)
+				So(problems[0].Type, ShouldEqual, "path")
+				So(problems[0].Component, ShouldEqual, "instance::db-1")
+				So(problems[1].Component, ShouldEqual, "instance::db-2")
+				So(problems[2].Component, ShouldEqual, "instance::db-2")
+			})
+		})
+	})
+}